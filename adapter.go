@@ -0,0 +1,71 @@
+package websocket
+
+// AdapterMessage is an encoded message fanned out to sockets on other nodes.
+// A message with a SocketID targets that socket only. Otherwise it goes to the
+// members of Rooms, or to every socket when Rooms is empty.
+type AdapterMessage struct {
+	Rooms       []string    `json:"rooms,omitempty"`
+	SocketID    string      `json:"socketId,omitempty"`
+	Except      []string    `json:"except,omitempty"`
+	MessageType MessageType `json:"messageType"`
+	Data        []byte      `json:"data"`
+}
+
+// Adapter connects a RoomManager to the room managers of other server
+// instances. The RoomManager reports local connections and memberships to the
+// adapter and publishes every broadcast through it; the adapter hands messages
+// published by other nodes to the deliver function passed to Start.
+type Adapter interface {
+	Start(deliver func(msg *AdapterMessage)) error
+	Publish(msg *AdapterMessage) error
+	AddSocket(socketID string) error
+	RemoveSocket(socketID string) error
+	Join(room string, socketID string) error
+	Leave(room string, socketID string) error
+	// RemoteSockets returns the IDs of the sockets connected to other nodes
+	// that are members of room, or of all remote sockets if room is empty.
+	RemoteSockets(room string) ([]string, error)
+	Close() error
+}
+
+// MemoryAdapter is the default adapter for a single server instance. It keeps
+// no state and never reaches other nodes.
+type MemoryAdapter struct{}
+
+var _ Adapter = &MemoryAdapter{}
+
+func NewMemoryAdapter() *MemoryAdapter {
+	return &MemoryAdapter{}
+}
+
+func (a *MemoryAdapter) Start(deliver func(msg *AdapterMessage)) error {
+	return nil
+}
+
+func (a *MemoryAdapter) Publish(msg *AdapterMessage) error {
+	return nil
+}
+
+func (a *MemoryAdapter) AddSocket(socketID string) error {
+	return nil
+}
+
+func (a *MemoryAdapter) RemoveSocket(socketID string) error {
+	return nil
+}
+
+func (a *MemoryAdapter) Join(room string, socketID string) error {
+	return nil
+}
+
+func (a *MemoryAdapter) Leave(room string, socketID string) error {
+	return nil
+}
+
+func (a *MemoryAdapter) RemoteSockets(room string) ([]string, error) {
+	return nil, nil
+}
+
+func (a *MemoryAdapter) Close() error {
+	return nil
+}
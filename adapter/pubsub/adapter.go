@@ -0,0 +1,259 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+	websocket "github.com/snapflowio/websocket"
+)
+
+const DefaultChannel = "websocket"
+
+var ErrNotStarted = errors.New("adapter not started")
+
+const (
+	packetMessage = "message"
+	packetAdd     = "add"
+	packetRemove  = "remove"
+	packetJoin    = "join"
+	packetLeave   = "leave"
+	packetHello   = "hello"
+	packetState   = "state"
+	packetBye     = "bye"
+)
+
+type packet struct {
+	Type    string                    `json:"type"`
+	Node    string                    `json:"node"`
+	Target  string                    `json:"target,omitempty"`
+	Socket  string                    `json:"socket,omitempty"`
+	Room    string                    `json:"room,omitempty"`
+	Sockets map[string][]string       `json:"sockets,omitempty"`
+	Message *websocket.AdapterMessage `json:"message,omitempty"`
+}
+
+// Adapter is a websocket.Adapter that shares broadcasts and memberships with
+// other nodes over a Broker channel. Every node keeps a copy of the sockets
+// and rooms of the others; a node that starts asks the others for theirs.
+type Adapter struct {
+	broker      Broker
+	channel     string
+	node        string
+	deliver     func(msg *websocket.AdapterMessage)
+	unsubscribe func()
+	mu          sync.RWMutex
+	local       map[string]map[string]bool
+	remote      map[string]map[string]map[string]bool
+}
+
+var _ websocket.Adapter = &Adapter{}
+
+func NewAdapter(broker Broker, channel string) *Adapter {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+
+	return &Adapter{
+		broker:  broker,
+		channel: channel,
+		node:    uuid.NewString(),
+		local:   make(map[string]map[string]bool),
+		remote:  make(map[string]map[string]map[string]bool),
+	}
+}
+
+// Node returns the ID this adapter uses to tell its packets apart
+func (a *Adapter) Node() string {
+	return a.node
+}
+
+func (a *Adapter) Start(deliver func(msg *websocket.AdapterMessage)) error {
+	a.mu.Lock()
+	a.deliver = deliver
+	a.mu.Unlock()
+
+	unsubscribe, err := a.broker.Subscribe(a.channel, a.handlePacket)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.unsubscribe = unsubscribe
+	a.mu.Unlock()
+	return a.publish(&packet{Type: packetHello})
+}
+
+func (a *Adapter) Publish(msg *websocket.AdapterMessage) error {
+	return a.publish(&packet{Type: packetMessage, Message: msg})
+}
+
+func (a *Adapter) AddSocket(socketID string) error {
+	a.mu.Lock()
+	if a.local[socketID] == nil {
+		a.local[socketID] = make(map[string]bool)
+	}
+	a.mu.Unlock()
+
+	return a.publish(&packet{Type: packetAdd, Socket: socketID})
+}
+
+func (a *Adapter) RemoveSocket(socketID string) error {
+	a.mu.Lock()
+	delete(a.local, socketID)
+	a.mu.Unlock()
+
+	return a.publish(&packet{Type: packetRemove, Socket: socketID})
+}
+
+func (a *Adapter) Join(room string, socketID string) error {
+	a.mu.Lock()
+	if a.local[socketID] == nil {
+		a.local[socketID] = make(map[string]bool)
+	}
+	a.local[socketID][room] = true
+	a.mu.Unlock()
+
+	return a.publish(&packet{Type: packetJoin, Socket: socketID, Room: room})
+}
+
+func (a *Adapter) Leave(room string, socketID string) error {
+	a.mu.Lock()
+	if rooms, ok := a.local[socketID]; ok {
+		delete(rooms, room)
+	}
+	a.mu.Unlock()
+
+	return a.publish(&packet{Type: packetLeave, Socket: socketID, Room: room})
+}
+
+func (a *Adapter) RemoteSockets(room string) ([]string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var ids []string
+	for _, sockets := range a.remote {
+		for id, rooms := range sockets {
+			if room == "" || rooms[room] {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+func (a *Adapter) Close() error {
+	a.mu.Lock()
+	unsubscribe := a.unsubscribe
+	a.unsubscribe = nil
+	a.mu.Unlock()
+	if unsubscribe == nil {
+		return nil
+	}
+
+	err := a.publish(&packet{Type: packetBye})
+	unsubscribe()
+	return err
+}
+
+func (a *Adapter) publish(p *packet) error {
+	a.mu.RLock()
+	started := a.unsubscribe != nil
+	a.mu.RUnlock()
+	if !started {
+		return ErrNotStarted
+	}
+
+	p.Node = a.node
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return a.broker.Publish(a.channel, payload)
+}
+
+func (a *Adapter) handlePacket(payload []byte) {
+	var p packet
+	if err := json.Unmarshal(payload, &p); err != nil || p.Node == a.node {
+		return
+	}
+
+	switch p.Type {
+	case packetMessage:
+		a.mu.RLock()
+		deliver := a.deliver
+		a.mu.RUnlock()
+		if deliver != nil && p.Message != nil {
+			deliver(p.Message)
+		}
+	case packetAdd:
+		a.mu.Lock()
+		a.remoteSocket(p.Node, p.Socket)
+		a.mu.Unlock()
+	case packetRemove:
+		a.mu.Lock()
+		delete(a.remote[p.Node], p.Socket)
+		a.mu.Unlock()
+	case packetJoin:
+		a.mu.Lock()
+		a.remoteSocket(p.Node, p.Socket)[p.Room] = true
+		a.mu.Unlock()
+	case packetLeave:
+		a.mu.Lock()
+		if rooms, ok := a.remote[p.Node][p.Socket]; ok {
+			delete(rooms, p.Room)
+		}
+		a.mu.Unlock()
+	case packetHello:
+		_ = a.publish(&packet{Type: packetState, Target: p.Node, Sockets: a.localState()})
+	case packetState:
+		if p.Target != a.node {
+			return
+		}
+
+		a.mu.Lock()
+		sockets := make(map[string]map[string]bool, len(p.Sockets))
+		for id, rooms := range p.Sockets {
+			sockets[id] = make(map[string]bool, len(rooms))
+			for _, room := range rooms {
+				sockets[id][room] = true
+			}
+		}
+		a.remote[p.Node] = sockets
+		a.mu.Unlock()
+	case packetBye:
+		a.mu.Lock()
+		delete(a.remote, p.Node)
+		a.mu.Unlock()
+	}
+}
+
+// remoteSocket returns the rooms of a remote socket, registering it if needed.
+// The caller must hold the write lock.
+func (a *Adapter) remoteSocket(node string, socketID string) map[string]bool {
+	if a.remote[node] == nil {
+		a.remote[node] = make(map[string]map[string]bool)
+	}
+
+	if a.remote[node][socketID] == nil {
+		a.remote[node][socketID] = make(map[string]bool)
+	}
+
+	return a.remote[node][socketID]
+}
+
+func (a *Adapter) localState() map[string][]string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	state := make(map[string][]string, len(a.local))
+	for id, rooms := range a.local {
+		state[id] = make([]string, 0, len(rooms))
+		for room := range rooms {
+			state[id] = append(state[id], room)
+		}
+	}
+
+	return state
+}
@@ -0,0 +1,126 @@
+package pubsub_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/adapter/pubsub"
+	"github.com/snapflowio/websocket/middleware/json"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+type note struct {
+	Text string `json:"text"`
+}
+
+type whisper struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// newNode starts a server connected to the other nodes on broker
+func newNode(t *testing.T, broker pubsub.Broker) *ws.Server {
+	t.Helper()
+	server := ws.NewServer(ws.WithCodec(json.Codec()))
+	if err := server.SetAdapter(pubsub.NewAdapter(broker, "test")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		server.Rooms().Adapter().Close()
+	})
+
+	if err := server.Use(json.Middleware()); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]func(ctx *ws.Context){
+		"join": func(ctx *ws.Context) {
+			ctx.Join("lobby")
+			ctx.Reply("joined")
+		},
+		"say": func(ctx *ws.Context) {
+			var msg note
+			ctx.Unmarshal(&msg)
+			ctx.To("lobby").EmitEvent("said", msg)
+		},
+		"whisper": func(ctx *ws.Context) {
+			var msg whisper
+			ctx.Unmarshal(&msg)
+			if err := ctx.EmitTo(msg.To, note{Text: msg.Text}); err != nil {
+				t.Errorf("EmitTo: %v", err)
+			}
+		},
+	}
+
+	for event, handler := range handlers {
+		if err := server.On(event, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return server
+}
+
+func text(t *testing.T, msg *wstest.Message) string {
+	t.Helper()
+	var n note
+	if err := msg.Unmarshal(&n); err != nil {
+		t.Fatalf("failed to decode %s: %v", msg.Raw, err)
+	}
+
+	return n.Text
+}
+
+func TestAdapterConnectsNodes(t *testing.T) {
+	broker := pubsub.NewLocalBroker()
+	serverA := newNode(t, broker)
+	serverB := newNode(t, broker)
+	alice := wstest.NewClient(t, serverA)
+	bob := wstest.NewClient(t, serverB)
+	alice.Request("join", nil)
+	bob.Request("join", nil)
+
+	for _, node := range []struct {
+		name   string
+		server *ws.Server
+		remote string
+	}{
+		{"A", serverA, bob.SocketID()},
+		{"B", serverB, alice.SocketID()},
+	} {
+		if size := node.server.Rooms().GetRoom("lobby").Size(); size != 1 {
+			t.Errorf("node %s: %d local members, want 1", node.name, size)
+		}
+
+		remote, err := node.server.Rooms().RemoteSockets("lobby")
+		if err != nil {
+			t.Fatalf("node %s: RemoteSockets: %v", node.name, err)
+		}
+
+		if !slices.Equal(remote, []string{node.remote}) {
+			t.Errorf("node %s: remote members %v, want [%s]", node.name, remote, node.remote)
+		}
+	}
+
+	alice.Emit("say", note{Text: "hello"})
+	if got := text(t, bob.ReceiveEvent("said")); got != "hello" {
+		t.Errorf("remote member got %q, want hello", got)
+	}
+
+	// Room emits from a handler skip the sender
+	alice.ExpectNoMessage(20 * time.Millisecond)
+
+	bob.Emit("whisper", whisper{To: alice.SocketID(), Text: "psst"})
+	if got := text(t, alice.Receive()); got != "psst" {
+		t.Errorf("remote socket got %q, want psst", got)
+	}
+
+	bob.Close(ws.StatusNormalClosure, "")
+	remote, _ := serverA.Rooms().RemoteSockets("lobby")
+	if len(remote) != 0 {
+		t.Errorf("remote members after disconnect: %v, want none", remote)
+	}
+}
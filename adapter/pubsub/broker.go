@@ -0,0 +1,59 @@
+package pubsub
+
+import "sync"
+
+// Broker is the minimal publish/subscribe transport the adapter needs. It can
+// be backed by Redis, NATS, Postgres LISTEN/NOTIFY or anything that fans a
+// payload out to every subscriber of a channel, including the publisher.
+type Broker interface {
+	Publish(channel string, payload []byte) error
+	Subscribe(channel string, handler func(payload []byte)) (unsubscribe func(), err error)
+}
+
+// LocalBroker is an in-process Broker. Servers sharing one LocalBroker behave
+// like nodes of a cluster, which makes it useful for tests.
+type LocalBroker struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[int]func(payload []byte)
+	nextID      int
+}
+
+var _ Broker = &LocalBroker{}
+
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{
+		subscribers: make(map[string]map[int]func(payload []byte)),
+	}
+}
+
+func (b *LocalBroker) Publish(channel string, payload []byte) error {
+	b.mu.RLock()
+	handlers := make([]func(payload []byte), 0, len(b.subscribers[channel]))
+	for _, handler := range b.subscribers[channel] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+
+	return nil
+}
+
+func (b *LocalBroker) Subscribe(channel string, handler func(payload []byte)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[channel] == nil {
+		b.subscribers[channel] = make(map[int]func(payload []byte))
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[channel][id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers[channel], id)
+	}, nil
+}
@@ -0,0 +1,488 @@
+// Package client is a Go client for servers using the json middleware. It
+// speaks the same id/event/meta/data envelope and routes events with the
+// same patterns as the server.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	ws "github.com/snapflowio/websocket"
+)
+
+const DefaultRequestTimeout = ws.DefaultRequestTimeout
+
+var (
+	ErrClosed       = errors.New("client closed")
+	ErrDisconnected = errors.New("client disconnected")
+	ErrNoMessageID  = errors.New("cannot reply to message without ID")
+)
+
+// Envelope is the message format of the json middleware
+type Envelope struct {
+	ID    string          `json:"id,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Meta  map[string]any  `json:"meta,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *ws.Error       `json:"error,omitempty"`
+}
+
+type Handler func(ctx *Context)
+
+type route struct {
+	pattern *ws.Pattern
+	handler Handler
+}
+
+type Client struct {
+	url              string
+	options          *options
+	logger           *logrus.Logger
+	requestTimeout   time.Duration
+	connMu           sync.Mutex
+	conn             *websocket.Conn
+	token            string
+	received         atomic.Uint64
+	closing          atomic.Bool
+	routesMu         sync.RWMutex
+	routes           []route
+	requestHandler   Handler
+	reconnectHandler func(resumed bool)
+	pendingMu        sync.Mutex
+	pending          map[string]chan *Envelope
+	roomsMu          sync.Mutex
+	rooms            map[string]bool
+	ctx              context.Context
+	cancelCtx        context.CancelFunc
+	done             chan struct{}
+	err              error
+}
+
+// Dial connects to a server and starts reading messages
+func Dial(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	o := &options{
+		subprotocols:   []string{"json"},
+		requestTimeout: DefaultRequestTimeout,
+		logger:         logrus.New(),
+		joinEvent:      "join",
+		leaveEvent:     "leave",
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	c := &Client{
+		url:            url,
+		options:        o,
+		logger:         o.logger,
+		requestTimeout: o.requestTimeout,
+		pending:        map[string]chan *Envelope{},
+		rooms:          map[string]bool{},
+		done:           make(chan struct{}),
+	}
+
+	c.ctx, c.cancelCtx = context.WithCancel(context.Background())
+	if _, err := c.connect(ctx); err != nil {
+		c.cancelCtx()
+		return nil, err
+	}
+
+	go c.run()
+	return c, nil
+}
+
+// On registers a handler for events matching pattern. Matching handlers run
+// in the order they were registered, each continuing the chain with
+// Context.Next.
+func (c *Client) On(pattern string, handler Handler) error {
+	p, err := ws.NewPattern(pattern)
+	if err != nil {
+		return &ws.InvalidPatternError{Pattern: pattern, Reason: err}
+	}
+
+	c.routesMu.Lock()
+	defer c.routesMu.Unlock()
+	c.routes = append(c.routes, route{pattern: p, handler: handler})
+	return nil
+}
+
+// OnRequest sets the handler for messages with an ID but no event, which is
+// how the server's Context.Request reaches the client. The handler answers
+// with Context.Reply.
+func (c *Client) OnRequest(handler Handler) {
+	c.routesMu.Lock()
+	defer c.routesMu.Unlock()
+	c.requestHandler = handler
+}
+
+// OnReconnect sets a function called after the client reconnected. resumed
+// reports whether the server resumed the previous session; if not, the
+// client has already sent Join again for its rooms.
+func (c *Client) OnReconnect(handler func(resumed bool)) {
+	c.routesMu.Lock()
+	defer c.routesMu.Unlock()
+	c.reconnectHandler = handler
+}
+
+func (c *Client) Emit(event string, data any) error {
+	return c.send(&Envelope{Event: event}, data)
+}
+
+// EmitWithMeta sends an event with meta data
+func (c *Client) EmitWithMeta(event string, meta map[string]any, data any) error {
+	return c.send(&Envelope{Event: event, Meta: meta}, data)
+}
+
+func (c *Client) Request(event string, data any) (json.RawMessage, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.requestTimeout)
+	defer cancel()
+	return c.RequestWithContext(ctx, event, data)
+}
+
+// RequestWithContext sends an event with a new message ID and waits for the
+// server to reply to it. An error reply is returned as a *ws.Error.
+func (c *Client) RequestWithContext(ctx context.Context, event string, data any) (json.RawMessage, error) {
+	id := uuid.NewString()
+	replyChan := make(chan *Envelope, 1)
+	c.pendingMu.Lock()
+	c.pending[id] = replyChan
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.send(&Envelope{ID: id, Event: event}, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replyChan:
+		if reply.Error != nil {
+			return nil, reply.Error
+		}
+
+		return reply.Data, nil
+	case <-c.done:
+		return nil, c.Err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Client) RequestInto(event string, data any, into any) error {
+	ctx, cancel := context.WithTimeout(c.ctx, c.requestTimeout)
+	defer cancel()
+	return c.RequestIntoWithContext(ctx, event, data, into)
+}
+
+func (c *Client) RequestIntoWithContext(ctx context.Context, event string, data any, into any) error {
+	reply, err := c.RequestWithContext(ctx, event, data)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(reply, into)
+}
+
+// Join sends the join event for a room and remembers the room, so it can be
+// joined again after reconnecting to a new session
+func (c *Client) Join(room string) error {
+	c.roomsMu.Lock()
+	c.rooms[room] = true
+	c.roomsMu.Unlock()
+	return c.Emit(c.options.joinEvent, map[string]string{"room": room})
+}
+
+func (c *Client) Leave(room string) error {
+	c.roomsMu.Lock()
+	delete(c.rooms, room)
+	c.roomsMu.Unlock()
+	return c.Emit(c.options.leaveEvent, map[string]string{"room": room})
+}
+
+// Rooms returns the rooms joined with Join
+func (c *Client) Rooms() []string {
+	c.roomsMu.Lock()
+	defer c.roomsMu.Unlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+
+	return rooms
+}
+
+// Connected reports whether the client currently has a connection
+func (c *Client) Connected() bool {
+	return c.currentConn() != nil
+}
+
+func (c *Client) Close() error {
+	return c.CloseWithStatus(ws.StatusNormalClosure, "")
+}
+
+func (c *Client) CloseWithStatus(status ws.Status, reason string) error {
+	c.closing.Store(true)
+	var err error
+	if conn := c.currentConn(); conn != nil {
+		err = conn.Close(status, reason)
+	}
+
+	c.cancelCtx()
+	<-c.done
+	return err
+}
+
+// Done is closed once the connection is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns the error that ended the connection. A close frame from the
+// server can be inspected with websocket.CloseStatus.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+func (c *Client) send(envelope *Envelope, data any) error {
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		envelope.Data = raw
+	}
+
+	msg, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	conn := c.currentConn()
+	if conn == nil {
+		if c.ctx.Err() != nil {
+			return ErrClosed
+		}
+
+		return ErrDisconnected
+	}
+
+	if err := conn.Write(c.ctx, websocket.MessageText, msg); err != nil {
+		if c.ctx.Err() != nil {
+			return ErrClosed
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) currentConn() *websocket.Conn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn
+}
+
+// connect dials the server, asking to resume the session of the previous
+// connection if there was one
+func (c *Client) connect(ctx context.Context) (bool, error) {
+	c.connMu.Lock()
+	token := c.token
+	c.connMu.Unlock()
+	target := c.url
+	if token != "" {
+		u, err := url.Parse(c.url)
+		if err != nil {
+			return false, err
+		}
+
+		query := u.Query()
+		query.Set(ws.ResumeTokenParam, token)
+		query.Set(ws.ResumeSeqParam, strconv.FormatUint(c.received.Load(), 10))
+		u.RawQuery = query.Encode()
+		target = u.String()
+	}
+
+	conn, res, err := websocket.Dial(ctx, target, &websocket.DialOptions{
+		HTTPClient:   c.options.httpClient,
+		HTTPHeader:   c.options.header,
+		Subprotocols: c.options.subprotocols,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if c.options.readLimit != 0 {
+		conn.SetReadLimit(c.options.readLimit)
+	}
+
+	resumed := token != "" && res.Header.Get(ws.SessionResumedHeader) == "true"
+	if !resumed {
+		c.received.Store(0)
+	}
+
+	c.connMu.Lock()
+	c.conn = conn
+	c.token = res.Header.Get(ws.SessionTokenHeader)
+	c.connMu.Unlock()
+	return resumed, nil
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+	defer c.cancelCtx()
+	for {
+		err := c.readLoop(c.currentConn())
+		c.connMu.Lock()
+		c.conn = nil
+		c.connMu.Unlock()
+		if !c.shouldReconnect(err) {
+			if websocket.CloseStatus(err) == -1 {
+				err = errors.Join(ErrClosed, err)
+			}
+
+			c.err = err
+			return
+		}
+
+		resumed, err := c.reconnect()
+		if err != nil {
+			c.err = err
+			return
+		}
+
+		go c.reconnected(resumed)
+	}
+}
+
+func (c *Client) readLoop(conn *websocket.Conn) error {
+	for {
+		_, data, err := conn.Read(c.ctx)
+		if err != nil {
+			return err
+		}
+
+		c.received.Add(1)
+		var envelope Envelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			c.logger.WithError(err).Warn("failed to decode message")
+			continue
+		}
+
+		c.dispatch(&envelope)
+	}
+}
+
+// shouldReconnect reports whether the connection was lost rather than
+// closed on purpose by either side
+func (c *Client) shouldReconnect(err error) bool {
+	if c.options.reconnect == nil || c.closing.Load() || c.ctx.Err() != nil {
+		return false
+	}
+
+	switch websocket.CloseStatus(err) {
+	case ws.StatusNormalClosure, ws.StatusPolicyViolation:
+		return false
+	}
+
+	return true
+}
+
+func (c *Client) reconnect() (bool, error) {
+	backoff := c.options.reconnect
+	var lastErr error
+	for attempt := 0; backoff.MaxAttempts == 0 || attempt < backoff.MaxAttempts; attempt++ {
+		select {
+		case <-time.After(backoff.Delay(attempt)):
+		case <-c.ctx.Done():
+			return false, ErrClosed
+		}
+
+		resumed, err := c.connect(c.ctx)
+		if err == nil {
+			if c.closing.Load() {
+				_ = c.currentConn().Close(ws.StatusNormalClosure, "")
+				return false, ErrClosed
+			}
+
+			return resumed, nil
+		}
+
+		c.logger.WithError(err).Debug("failed to reconnect")
+		lastErr = err
+	}
+
+	return false, errors.Join(ErrClosed, lastErr)
+}
+
+func (c *Client) reconnected(resumed bool) {
+	if !resumed {
+		for _, room := range c.Rooms() {
+			if err := c.Emit(c.options.joinEvent, map[string]string{"room": room}); err != nil {
+				c.logger.WithError(err).Warn("failed to join room again")
+			}
+		}
+	}
+
+	c.routesMu.RLock()
+	handler := c.reconnectHandler
+	c.routesMu.RUnlock()
+	if handler != nil {
+		handler(resumed)
+	}
+}
+
+func (c *Client) dispatch(envelope *Envelope) {
+	if envelope.ID != "" {
+		c.pendingMu.Lock()
+		replyChan, ok := c.pending[envelope.ID]
+		delete(c.pending, envelope.ID)
+		c.pendingMu.Unlock()
+		if ok {
+			replyChan <- envelope
+			return
+		}
+	}
+
+	c.routesMu.RLock()
+	var handlers []matchedHandler
+	if envelope.Event == "" {
+		if envelope.ID != "" && envelope.Error == nil && c.requestHandler != nil {
+			handlers = append(handlers, matchedHandler{handler: c.requestHandler})
+		}
+	} else {
+		for _, r := range c.routes {
+			if params, ok := r.pattern.MatchParams(envelope.Event); ok {
+				handlers = append(handlers, matchedHandler{handler: r.handler, params: params})
+			}
+		}
+	}
+	c.routesMu.RUnlock()
+
+	if len(handlers) == 0 {
+		return
+	}
+
+	ctx := &Context{client: c, envelope: envelope, handlers: handlers}
+	go ctx.Next()
+}
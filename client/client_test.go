@@ -0,0 +1,387 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/client"
+	"github.com/snapflowio/websocket/middleware/json"
+)
+
+type sum struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type total struct {
+	Sum int `json:"sum"`
+}
+
+type room struct {
+	Room string `json:"room"`
+}
+
+func newServer(t *testing.T, opts ...ws.ServerOption) *ws.Server {
+	t.Helper()
+	server := ws.NewServer(append([]ws.ServerOption{ws.WithCodec(json.Codec())}, opts...)...)
+	if err := server.Use(json.Middleware()); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]any{
+		"add": ws.Typed(func(ctx *ws.Context, req sum) (total, error) {
+			return total{Sum: req.A + req.B}, nil
+		}),
+		"missing": func(ctx *ws.Context) {
+			ctx.Error = ws.NewError(ws.CodeNotFound, "no such thing")
+		},
+		"hang": func(ctx *ws.Context) {
+			<-ctx.Socket().Done()
+		},
+		"ask": func(ctx *ws.Context) {
+			var answer total
+			if err := ctx.RequestIntoWithTimeout(sum{A: 2, B: 3}, &answer, time.Second); err != nil {
+				ctx.Error = err
+				return
+			}
+
+			ctx.Reply(answer)
+		},
+		"greet": func(ctx *ws.Context) {
+			var msg room
+			ctx.Unmarshal(&msg)
+			ctx.SendEvent("greeting."+msg.Room, msg)
+		},
+		"join": func(ctx *ws.Context) {
+			var msg room
+			ctx.Unmarshal(&msg)
+			ctx.Join(msg.Room)
+		},
+	}
+
+	for event, handler := range handlers {
+		if err := server.On(event, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return server
+}
+
+// serve starts an HTTP server for server and returns its websocket URL
+func serve(t *testing.T, server *ws.Server) string {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func dial(t *testing.T, endpoint string, opts ...client.Option) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	c, err := client.Dial(ctx, endpoint, opts...)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	t.Cleanup(func() {
+		c.Close()
+	})
+
+	return c
+}
+
+func TestRequestsGetTheirOwnReplies(t *testing.T) {
+	c := dial(t, serve(t, newServer(t)))
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var got total
+			if err := c.RequestInto("add", sum{A: i, B: 1}, &got); err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+
+			if got.Sum != i+1 {
+				t.Errorf("request %d got sum %d, want %d", i, got.Sum, i+1)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+func TestRequestReturnsErrorReply(t *testing.T) {
+	c := dial(t, serve(t, newServer(t)))
+	_, err := c.Request("missing", nil)
+	var wsErr *ws.Error
+	if !errors.As(err, &wsErr) || wsErr.Code != ws.CodeNotFound || wsErr.Message != "no such thing" {
+		t.Fatalf("Request returned %v, want the not found error", err)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	c := dial(t, serve(t, newServer(t)), client.WithRequestTimeout(20*time.Millisecond))
+	if _, err := c.Request("hang", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Request returned %v, want context.DeadlineExceeded", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.RequestWithContext(ctx, "hang", nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RequestWithContext returned %v, want context.Canceled", err)
+	}
+
+	// The client still works after the timeouts
+	var got total
+	if err := c.RequestInto("add", sum{A: 1, B: 2}, &got); err != nil || got.Sum != 3 {
+		t.Fatalf("RequestInto = %+v, %v", got, err)
+	}
+}
+
+func TestOnRequestAnswersServer(t *testing.T) {
+	c := dial(t, serve(t, newServer(t)))
+	c.OnRequest(func(ctx *client.Context) {
+		var question sum
+		if err := ctx.Unmarshal(&question); err != nil {
+			t.Errorf("Unmarshal: %v", err)
+		}
+
+		ctx.Reply(total{Sum: question.A + question.B})
+	})
+
+	var answer total
+	if err := c.RequestInto("ask", nil, &answer); err != nil || answer.Sum != 5 {
+		t.Fatalf("server got %+v, %v from the request handler", answer, err)
+	}
+}
+
+func TestOnMatchesPatterns(t *testing.T) {
+	c := dial(t, serve(t, newServer(t)))
+	rooms := make(chan string, 1)
+	if err := c.On("greeting.:room", func(ctx *client.Context) {
+		rooms <- ctx.Param("room")
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Emit("greet", room{Room: "lobby"}); err != nil {
+		t.Fatalf("Emit: %v", err)
+	}
+
+	select {
+	case got := <-rooms:
+		if got != "lobby" {
+			t.Fatalf("room = %q, want lobby", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not handled")
+	}
+}
+
+func TestClose(t *testing.T) {
+	server := newServer(t)
+	statuses := make(chan ws.Status, 1)
+	if err := server.UseClose(func(ctx *ws.Context) {
+		status, _, _ := ctx.CloseStatus()
+		statuses <- status
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	c := dial(t, serve(t, server))
+	pending := make(chan error, 1)
+	go func() {
+		_, err := c.RequestWithContext(context.Background(), "hang", nil)
+		pending <- err
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case <-c.Done():
+	default:
+		t.Fatal("Done is open after Close")
+	}
+
+	if err := <-pending; err == nil {
+		t.Fatal("pending request succeeded after Close")
+	}
+
+	if err := c.Emit("add", nil); !errors.Is(err, client.ErrClosed) {
+		t.Fatalf("Emit after Close returned %v, want ErrClosed", err)
+	}
+
+	if status := <-statuses; status != ws.StatusNormalClosure {
+		t.Fatalf("server saw close status %d, want %d", status, ws.StatusNormalClosure)
+	}
+}
+
+// dropper records the network connections of a client so a test can cut
+// them without a close frame, like a lost connection
+type dropper struct {
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (d *dropper) httpClient() *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err == nil {
+				d.mu.Lock()
+				d.conns = append(d.conns, conn)
+				d.mu.Unlock()
+			}
+
+			return conn, err
+		},
+	}}
+}
+
+func (d *dropper) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, conn := range d.conns {
+		conn.Close()
+	}
+
+	d.conns = nil
+}
+
+// waitForMember waits until room has a member other than previous and
+// returns its ID
+func waitForMember(t *testing.T, server *ws.Server, name, previous string) string {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if room := server.Rooms().GetRoom(name); room != nil {
+			for _, socket := range server.Sockets() {
+				if socket.ID() != previous && !socket.IsClosed() && room.Has(socket) {
+					return socket.ID()
+				}
+			}
+		}
+	}
+
+	t.Fatalf("no new member joined %s", name)
+	return ""
+}
+
+func TestReconnectResumesSession(t *testing.T) {
+	server := newServer(t, ws.WithResumption(time.Minute, 16))
+	queries := make(chan url.Values, 2)
+	proceed := make(chan struct{})
+	server.OnUpgrade(func(r *http.Request) (ws.UpgradeDecision, error) {
+		queries <- r.URL.Query()
+		if r.URL.Query().Has(ws.ResumeTokenParam) {
+			<-proceed
+		}
+
+		return ws.UpgradeDecision{}, nil
+	})
+
+	if err := server.UseOpen(func(ctx *ws.Context) {
+		if !ctx.Resumed() {
+			server.EmitToSocket(ctx.SocketID(), "welcome", nil)
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &dropper{}
+	c := dial(t, serve(t, server),
+		client.WithHTTPClient(d.httpClient()),
+		client.WithReconnect(client.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond}),
+	)
+
+	events := make(chan string, 4)
+	if err := c.On("*", func(ctx *client.Context) {
+		events <- ctx.Event()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	reconnects := make(chan bool, 1)
+	c.OnReconnect(func(resumed bool) {
+		reconnects <- resumed
+	})
+
+	<-queries
+	if event := <-events; event != "welcome" {
+		t.Fatalf("got %q, want welcome", event)
+	}
+
+	if err := c.Join("lobby"); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	id := waitForMember(t, server, "lobby", "")
+	socket := server.Socket(id)
+	d.drop()
+	<-socket.Done()
+	// Give the server a moment to detach the session of the dropped socket
+	time.Sleep(50 * time.Millisecond)
+	server.To("lobby").Emit("missed", nil)
+	close(proceed)
+
+	query := <-queries
+	if query.Get(ws.ResumeTokenParam) == "" || query.Get(ws.ResumeSeqParam) != "1" {
+		t.Fatalf("reconnect query = %v, want the session token and last seq 1", query)
+	}
+
+	if resumed := <-reconnects; !resumed {
+		t.Fatal("session was not resumed")
+	}
+
+	if event := <-events; event != "missed" {
+		t.Fatalf("got %q, want the missed message", event)
+	}
+
+	if !server.Rooms().GetRoom("lobby").Has(server.Socket(id)) {
+		t.Fatal("resumed socket left the lobby")
+	}
+}
+
+func TestReconnectRejoinsRooms(t *testing.T) {
+	server := newServer(t)
+	d := &dropper{}
+	c := dial(t, serve(t, server),
+		client.WithHTTPClient(d.httpClient()),
+		client.WithReconnect(client.Backoff{Min: 10 * time.Millisecond, Max: 10 * time.Millisecond}),
+	)
+
+	reconnects := make(chan bool, 1)
+	c.OnReconnect(func(resumed bool) {
+		reconnects <- resumed
+	})
+
+	if err := c.Join("lobby"); err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+
+	first := waitForMember(t, server, "lobby", "")
+	d.drop()
+	if resumed := <-reconnects; resumed {
+		t.Fatal("server without resumption resumed the session")
+	}
+
+	waitForMember(t, server, "lobby", first)
+	if !c.Connected() {
+		t.Fatal("client is not connected after reconnecting")
+	}
+}
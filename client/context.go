@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"runtime/debug"
+	"time"
+)
+
+type matchedHandler struct {
+	handler Handler
+	params  map[string]string
+}
+
+// Context carries a message received from the server through the handlers
+// matching its event
+type Context struct {
+	client   *Client
+	envelope *Envelope
+	handlers []matchedHandler
+	index    int
+	params   map[string]string
+	values   map[string]any
+}
+
+var _ context.Context = &Context{}
+
+// Next runs the next handler matching the message's event
+func (c *Context) Next() {
+	if c.index >= len(c.handlers) {
+		return
+	}
+
+	current := c.handlers[c.index]
+	c.index++
+	c.params = current.params
+	defer func() {
+		if r := recover(); r != nil {
+			c.client.logger.WithField("stack", string(debug.Stack())).Errorf("panic in handler: %v", r)
+		}
+	}()
+
+	current.handler(c)
+}
+
+func (c *Context) Client() *Client {
+	return c.client
+}
+
+func (c *Context) MessageID() string {
+	return c.envelope.ID
+}
+
+func (c *Context) Event() string {
+	return c.envelope.Event
+}
+
+func (c *Context) Meta() map[string]any {
+	return c.envelope.Meta
+}
+
+// Data returns the raw JSON data of the message
+func (c *Context) Data() json.RawMessage {
+	return c.envelope.Data
+}
+
+func (c *Context) Unmarshal(into any) error {
+	return json.Unmarshal(c.envelope.Data, into)
+}
+
+// Param returns the value of a named parameter in the matched pattern
+func (c *Context) Param(key string) string {
+	return c.params[key]
+}
+
+func (c *Context) Params() map[string]string {
+	params := make(map[string]string, len(c.params))
+	for k, v := range c.params {
+		params[k] = v
+	}
+
+	return params
+}
+
+// Set stores a value for the remaining handlers of this message
+func (c *Context) Set(key string, value any) {
+	if c.values == nil {
+		c.values = map[string]any{}
+	}
+
+	c.values[key] = value
+}
+
+func (c *Context) Get(key string) (any, bool) {
+	v, ok := c.values[key]
+	return v, ok
+}
+
+func (c *Context) Emit(event string, data any) error {
+	return c.client.Emit(event, data)
+}
+
+// Reply answers the message with its ID
+func (c *Context) Reply(data any) error {
+	if c.envelope.ID == "" {
+		return ErrNoMessageID
+	}
+
+	return c.client.send(&Envelope{ID: c.envelope.ID}, data)
+}
+
+// ReplyEvent answers the message with its ID and an event
+func (c *Context) ReplyEvent(event string, data any) error {
+	if c.envelope.ID == "" {
+		return ErrNoMessageID
+	}
+
+	return c.client.send(&Envelope{ID: c.envelope.ID, Event: event}, data)
+}
+
+func (c *Context) Request(event string, data any) (json.RawMessage, error) {
+	return c.client.Request(event, data)
+}
+
+func (c *Context) RequestInto(event string, data any, into any) error {
+	return c.client.RequestInto(event, data, into)
+}
+
+func (c *Context) Deadline() (time.Time, bool) {
+	return c.client.ctx.Deadline()
+}
+
+func (c *Context) Done() <-chan struct{} {
+	return c.client.ctx.Done()
+}
+
+func (c *Context) Err() error {
+	return c.client.ctx.Err()
+}
+
+func (c *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if v, ok := c.values[k]; ok {
+			return v
+		}
+	}
+
+	return c.client.ctx.Value(key)
+}
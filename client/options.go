@@ -0,0 +1,122 @@
+package client
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type options struct {
+	header         http.Header
+	httpClient     *http.Client
+	subprotocols   []string
+	readLimit      int64
+	requestTimeout time.Duration
+	logger         *logrus.Logger
+	reconnect      *Backoff
+	joinEvent      string
+	leaveEvent     string
+}
+
+// Backoff is the delay between reconnection attempts. Each attempt waits
+// Factor times longer than the previous one, between Min and Max, with a
+// random part of the delay taken off to spread out clients.
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	// Jitter is the fraction of each delay that is randomized, from 0 to 1
+	Jitter float64
+	// MaxAttempts limits consecutive failed attempts. Zero means no limit.
+	MaxAttempts int
+}
+
+var DefaultBackoff = Backoff{
+	Min:    500 * time.Millisecond,
+	Max:    30 * time.Second,
+	Factor: 2,
+	Jitter: 0.5,
+}
+
+// Delay returns how long to wait before the given attempt, starting at 0
+func (b Backoff) Delay(attempt int) time.Duration {
+	factor := b.Factor
+	if factor < 1 {
+		factor = 1
+	}
+
+	delay := float64(b.Min) * math.Pow(factor, float64(attempt))
+	if b.Max > 0 && delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+
+	delay -= delay * b.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// Option configures a Client created with Dial
+type Option func(o *options)
+
+// WithHeader sets headers sent with the upgrade request
+func WithHeader(header http.Header) Option {
+	return func(o *options) {
+		o.header = header
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = httpClient
+	}
+}
+
+// WithSubprotocols sets the subprotocols requested from the server. It
+// defaults to "json".
+func WithSubprotocols(subprotocols ...string) Option {
+	return func(o *options) {
+		o.subprotocols = subprotocols
+	}
+}
+
+// WithReadLimit sets the maximum size in bytes of a message read from the
+// server. -1 removes the limit.
+func WithReadLimit(limit int64) Option {
+	return func(o *options) {
+		o.readLimit = limit
+	}
+}
+
+// WithRequestTimeout sets the timeout used by Request and RequestInto
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.requestTimeout = timeout
+	}
+}
+
+func WithLogger(logger *logrus.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithReconnect makes the client reconnect when the connection is lost.
+// With a server that has resumption enabled, the client gets its session
+// back along with the messages it missed. Otherwise it joins its rooms
+// again.
+func WithReconnect(backoff Backoff) Option {
+	return func(o *options) {
+		o.reconnect = &backoff
+	}
+}
+
+// WithRoomEvents sets the events Join and Leave send. They default to
+// "join" and "leave".
+func WithRoomEvents(join, leave string) Option {
+	return func(o *options) {
+		o.joinEvent = join
+		o.leaveEvent = leave
+	}
+}
@@ -0,0 +1,215 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codec encodes and decodes the message envelope of one subprotocol
+type Codec interface {
+	// Name is the subprotocol that selects the codec
+	Name() string
+	// Decode reads the envelope of a raw message
+	Decode(raw []byte) (*Envelope, error)
+	// Unmarshal decodes the data of a message read by Decode into v
+	Unmarshal(message *InboundMessage, into any) error
+	// Encode builds the raw message sent for message
+	Encode(message *OutboundMessage) ([]byte, error)
+	// MessageType is the frame type of encoded messages
+	MessageType() MessageType
+}
+
+// Sniffer is implemented by codecs that recognize their own messages. It
+// lets Negotiator pick a codec per message for connections that did not
+// negotiate a subprotocol.
+type Sniffer interface {
+	Sniff(messageType MessageType, raw []byte) bool
+}
+
+// Envelope holds the fields a Codec reads from a raw message
+type Envelope struct {
+	ID    string
+	Event string
+	Meta  map[string]any
+	Data  []byte
+}
+
+// Negotiator is a middleware that decodes messages with the codec of the
+// socket's subprotocol and installs its marshaller and unmarshaler on the
+// context. It is also an open handler, so open handlers that follow it can
+// send messages.
+//
+//	negotiator := websocket.Negotiate(msgpack.Codec(), json.Codec())
+//	server := websocket.NewServer(websocket.WithSubprotocols(negotiator.Subprotocols()...))
+//	server.Use(negotiator)
+type Negotiator struct {
+	codecs []Codec
+	byName map[string]Codec
+}
+
+var _ Handler = &Negotiator{}
+var _ OpenHandler = &Negotiator{}
+
+// Negotiate creates a Negotiator for codecs. Messages of sockets without a
+// subprotocol are decoded with the first codec that sniffs them, the codec
+// of the socket's previous message or the first codec. If that fails, the
+// message is passed on undecoded.
+func Negotiate(codecs ...Codec) *Negotiator {
+	n := &Negotiator{
+		codecs: codecs,
+		byName: make(map[string]Codec, len(codecs)),
+	}
+
+	for _, codec := range codecs {
+		n.byName[codec.Name()] = codec
+	}
+
+	return n
+}
+
+// Subprotocols returns the names of the codecs in order of preference
+func (n *Negotiator) Subprotocols() []string {
+	names := make([]string, len(n.codecs))
+	for i, codec := range n.codecs {
+		names[i] = codec.Name()
+	}
+
+	return names
+}
+
+func (n *Negotiator) Handle(ctx *Context) {
+	codec, negotiated, err := n.negotiated(ctx)
+	if err != nil {
+		ctx.Error = err
+		return
+	}
+
+	if codec == nil {
+		codec = n.sniff(ctx)
+	}
+
+	if codec == nil {
+		ctx.Next()
+		return
+	}
+
+	envelope, err := codec.Decode(ctx.RawData())
+	if err != nil {
+		if !negotiated {
+			// Not an envelope; left to the handlers as raw data
+			ctx.Next()
+			return
+		}
+
+		ctx.Error = fmt.Errorf("%w: %v", ErrInvalidData, err)
+		return
+	}
+
+	ctx.socket.SetCodec(codec)
+	if envelope.ID != "" {
+		ctx.SetMessageID(envelope.ID)
+	}
+
+	if envelope.Event != "" {
+		ctx.SetMessageEvent(envelope.Event)
+	}
+
+	if envelope.Meta != nil {
+		ctx.SetMessageMeta(envelope.Meta)
+	}
+
+	if envelope.Data != nil {
+		ctx.SetMessageData(envelope.Data)
+	}
+
+	ctx.UseCodec(codec)
+	ctx.Next()
+}
+
+func (n *Negotiator) HandleOpen(ctx *Context) {
+	codec, negotiated, err := n.negotiated(ctx)
+	if err != nil {
+		ctx.Error = err
+		return
+	}
+
+	if negotiated {
+		ctx.socket.SetCodec(codec)
+	} else {
+		// Set by middleware that handles the socket's protocol itself
+		codec = ctx.socket.Codec()
+	}
+
+	if codec == nil {
+		if len(n.codecs) == 0 {
+			return
+		}
+
+		codec = n.codecs[0]
+	}
+
+	ctx.UseCodec(codec)
+}
+
+// negotiated returns the codec of the socket's subprotocol, or nil if it has
+// none. A subprotocol without a codec is an error.
+func (n *Negotiator) negotiated(ctx *Context) (Codec, bool, error) {
+	subprotocol := ctx.Subprotocol()
+	if subprotocol == "" {
+		subprotocol = strings.TrimSpace(ctx.Headers().Get("Sec-WebSocket-Protocol"))
+	}
+
+	if subprotocol == "" {
+		return nil, false, nil
+	}
+
+	codec, ok := n.byName[subprotocol]
+	if !ok {
+		return nil, false, fmt.Errorf("unsupported WebSocket subprotocol: %s", subprotocol)
+	}
+
+	return codec, true, nil
+}
+
+func (n *Negotiator) sniff(ctx *Context) Codec {
+	for _, codec := range n.codecs {
+		if sniffer, ok := codec.(Sniffer); ok && sniffer.Sniff(ctx.MessageType(), ctx.RawData()) {
+			return codec
+		}
+	}
+
+	if codec := ctx.socket.Codec(); codec != nil {
+		return codec
+	}
+
+	if len(n.codecs) > 0 {
+		return n.codecs[0]
+	}
+
+	return nil
+}
+
+// UseCodec installs the marshaller, unmarshaler and frame type of codec on
+// the context
+func (c *Context) UseCodec(codec Codec) {
+	c.messageUnmarshaler = codec.Unmarshal
+	c.messageMarshaller = codec.Encode
+	c.messageType = codec.MessageType()
+}
+
+// Codec returns the codec last used to decode a message from the socket, or
+// the one of its subprotocol. It is nil until a Negotiator has seen the
+// socket.
+func (s *Socket) Codec() Codec {
+	if codec := s.codec.Load(); codec != nil {
+		return *codec
+	}
+
+	return nil
+}
+
+// SetCodec sets the codec the socket uses. Middleware that decodes messages
+// itself calls it so that Codec reports the right one.
+func (s *Socket) SetCodec(codec Codec) {
+	s.codec.Store(&codec)
+}
@@ -25,13 +25,20 @@ type Context struct {
 	messageMarshaller         func(message *OutboundMessage) ([]byte, error)
 	currentHandlerNode        *HandlerNode
 	currentHandlerNodeMatches bool
+	router                    *Router
+	routeMatches              []routeMatch
+	routeEvent                string
+	routeMatched              bool
+	params                    map[string]string
 	associatedValues          map[string]any
+	slot                      *processingSlot
 	currentHandlerIndex       int
 	currentHandler            any
 	ctx                       context.Context
 	cancelCtx                 context.CancelFunc
 	Error                     error
 	ErrorStack                string
+	errorHandled              bool
 }
 
 var _ context.Context = &Context{}
@@ -58,6 +65,18 @@ func NewContextWithNodeAndMessageType(socket *Socket, message *InboundMessage, f
 	return ctx
 }
 
+func NewContextWithRouter(socket *Socket, message *InboundMessage, router *Router, messageType websocket.MessageType) *Context {
+	ctx := NewContextWithNodeAndMessageType(socket, message, router.First(), messageType)
+	ctx.router = router
+	return ctx
+}
+
+func NewSubContextWithRouter(ctx *Context, router *Router) *Context {
+	subCtx := NewSubContextWithNode(ctx, router.First())
+	subCtx.router = router
+	return subCtx
+}
+
 func NewSubContextWithNode(ctx *Context, firstHandlerNode *HandlerNode) *Context {
 	subCtx := contextFromPool()
 	subCtx.ctx, subCtx.cancelCtx = context.WithCancel(ctx)
@@ -66,15 +85,19 @@ func NewSubContextWithNode(ctx *Context, firstHandlerNode *HandlerNode) *Context
 	subMsg := inboundMessageFromPool()
 	subMsg.hasSetID = ctx.message.hasSetID
 	subMsg.hasSetEvent = ctx.message.hasSetEvent
+	subMsg.hasClientID = ctx.message.hasClientID
 	subMsg.ID = ctx.message.ID
 	subMsg.Event = ctx.message.Event
 	subMsg.RawData = ctx.message.RawData
 	subMsg.Data = ctx.message.Data
 	subMsg.Meta = ctx.message.Meta
 	subCtx.message = subMsg
+	subCtx.params = ctx.params
+	subCtx.slot = ctx.slot
 	subCtx.messageType = ctx.messageType
 	subCtx.Error = ctx.Error
 	subCtx.ErrorStack = ctx.ErrorStack
+	subCtx.errorHandled = ctx.errorHandled
 	subCtx.messageUnmarshaler = ctx.messageUnmarshaler
 	subCtx.messageMarshaller = ctx.messageMarshaller
 	for k, v := range ctx.associatedValues {
@@ -108,10 +131,17 @@ func (c *Context) free() {
 	c.messageType = 0
 	c.Error = nil
 	c.ErrorStack = ""
+	c.errorHandled = false
 	c.messageUnmarshaler = nil
 	c.messageMarshaller = nil
 	c.currentHandlerNode = nil
 	c.currentHandlerNodeMatches = false
+	c.router = nil
+	c.routeMatches = nil
+	c.routeEvent = ""
+	c.routeMatched = false
+	c.params = nil
+	c.slot = nil
 	c.currentHandlerIndex = 0
 	c.currentHandler = nil
 
@@ -189,6 +219,12 @@ func (c *Context) Delete(key string) {
 	delete(c.associatedValues, key)
 }
 
+// Socket returns the socket that sent the message. It is nil once the
+// context has been freed.
+func (c *Context) Socket() *Socket {
+	return c.socket
+}
+
 func (c *Context) SocketID() string {
 	if c.socket == nil {
 		return ""
@@ -209,6 +245,12 @@ func (c *Context) MessageID() string {
 	return c.message.ID
 }
 
+// HasMessageID reports whether the client sent the message with an ID and
+// so expects a reply. Messages without one get a generated ID.
+func (c *Context) HasMessageID() bool {
+	return c.message.hasClientID
+}
+
 func (c *Context) RawData() []byte {
 	return c.message.RawData
 }
@@ -221,6 +263,22 @@ func (c *Context) Event() string {
 	return c.message.Event
 }
 
+// Param returns the value captured by a named parameter of the pattern that
+// matched the current handler, e.g. "roomId" for "chat.:roomId.message".
+func (c *Context) Param(key string) string {
+	return c.params[key]
+}
+
+// Params returns all values captured by the pattern that matched the current handler
+func (c *Context) Params() map[string]string {
+	params := make(map[string]string, len(c.params))
+	for k, v := range c.params {
+		params[k] = v
+	}
+
+	return params
+}
+
 func (c *Context) MessageType() MessageType {
 	return MessageType(c.messageType)
 }
@@ -251,6 +309,24 @@ func (c *Context) QueryParams() map[string]string {
 	return c.socket.QueryParams()
 }
 
+// Subprotocol returns the subprotocol negotiated with the client, if any
+func (c *Context) Subprotocol() string {
+	if c.socket == nil {
+		return ""
+	}
+
+	return c.socket.Subprotocol()
+}
+
+// Resumed reports whether the socket resumed the session of a dropped one
+func (c *Context) Resumed() bool {
+	if c.socket == nil {
+		return false
+	}
+
+	return c.socket.Resumed()
+}
+
 func (c *Context) RemoteAddr() string {
 	if c.socket == nil {
 		return ""
@@ -271,9 +347,16 @@ func (c *Context) SetMessageMarshaller(marshaller func(message *OutboundMessage)
 	c.messageMarshaller = marshaller
 }
 
+// SetMessageType sets the frame type used for replies and other messages
+// sent through the context
+func (c *Context) SetMessageType(messageType MessageType) {
+	c.messageType = messageType
+}
+
 func (c *Context) SetMessageID(id string) {
 	c.message.ID = id
 	c.message.hasSetID = true
+	c.message.hasClientID = id != ""
 }
 
 func (c *Context) SetMessageEvent(event string) {
@@ -396,6 +479,10 @@ func (c *Context) RequestWithContext(ctx context.Context, data any) (any, error)
 		return nil, ErrContextFreed
 	}
 
+	if c.slot != nil && c.slot.sequential() {
+		return nil, ErrSequentialRequest
+	}
+
 	id := uuid.NewString()
 	responseMessageChan := make(chan *InboundMessage, 1)
 	defer close(responseMessageChan)
@@ -414,14 +501,14 @@ func (c *Context) RequestWithContext(ctx context.Context, data any) (any, error)
 		return nil, err
 	}
 
-	select {
-	case responseMessage := <-responseMessageChan:
-		data := responseMessage.Data
-		responseMessage.free()
-		return data, nil
-	case <-ctx.Done():
-		return nil, fmt.Errorf("request cancelled: %w", ctx.Err())
+	responseMessage, err := c.awaitReply(ctx, responseMessageChan)
+	if err != nil {
+		return nil, err
 	}
+
+	reply := responseMessage.Data
+	responseMessage.free()
+	return reply, nil
 }
 
 func (c *Context) RequestInto(data any, into any) error {
@@ -442,6 +529,10 @@ func (c *Context) RequestIntoWithContext(ctx context.Context, data any, into any
 		return ErrContextFreed
 	}
 
+	if c.slot != nil && c.slot.sequential() {
+		return ErrSequentialRequest
+	}
+
 	id := uuid.NewString()
 	responseMessageChan := make(chan *InboundMessage, 1)
 	defer close(responseMessageChan)
@@ -461,14 +552,40 @@ func (c *Context) RequestIntoWithContext(ctx context.Context, data any, into any
 		return err
 	}
 
-	select {
-	case responseMessage := <-responseMessageChan:
-		err := c.unmarshalInboundMessage(responseMessage, into)
-		responseMessage.free()
+	responseMessage, err := c.awaitReply(ctx, responseMessageChan)
+	if err != nil {
 		return err
+	}
+
+	err = c.unmarshalInboundMessage(responseMessage, into)
+	responseMessage.free()
+	return err
+}
+
+// awaitReply waits for the reply to a request. A bounded socket keeps reading
+// meanwhile: the message gives up its processing slot until the reply came.
+func (c *Context) awaitReply(ctx context.Context, replies chan *InboundMessage) (*InboundMessage, error) {
+	if c.slot != nil {
+		c.slot.yield()
+	}
+
+	var reply *InboundMessage
+	var err error
+	select {
+	case reply = <-replies:
 	case <-ctx.Done():
-		return fmt.Errorf("request cancelled: %w", ctx.Err())
+		err = fmt.Errorf("request cancelled: %w", ctx.Err())
+	}
+
+	if c.slot != nil && !c.slot.reclaim() {
+		if reply != nil {
+			reply.free()
+		}
+
+		return nil, ErrSocketClosed
 	}
+
+	return reply, err
 }
 
 func (c *Context) Close() {
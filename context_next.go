@@ -25,7 +25,7 @@ func (c *Context) Next() {
 	}
 
 	if c.message.hasSetEvent {
-		if c.currentHandlerNodeMatches && !c.currentHandlerNode.tryMatch(c) {
+		if c.currentHandlerNodeMatches && !c.nodeMatches(c.currentHandlerNode) {
 			c.currentHandlerNode = c.currentHandlerNode.Next
 			c.currentHandlerNodeMatches = false
 			c.currentHandlerIndex = 0
@@ -37,17 +37,11 @@ func (c *Context) Next() {
 
 	for c.currentHandlerNode != nil {
 		if !c.currentHandlerNodeMatches {
-			for c.currentHandlerNode != nil {
-				if c.currentHandlerNode.tryMatch(c) {
-					c.currentHandlerNodeMatches = true
-					break
-				}
-
-				c.currentHandlerNode = c.currentHandlerNode.Next
-			}
-			if !c.currentHandlerNodeMatches {
+			c.currentHandlerNode = c.nextMatchingNode(c.currentHandlerNode)
+			if c.currentHandlerNode == nil {
 				break
 			}
+			c.currentHandlerNodeMatches = true
 		}
 		if c.currentHandlerIndex < len(c.currentHandlerNode.Handlers) {
 			c.currentHandler = c.currentHandlerNode.Handlers[c.currentHandlerIndex]
@@ -99,6 +93,60 @@ func (c *Context) Next() {
 	c.currentHandler = nil
 }
 
+// nextMatchingNode returns the first node, starting at from, that matches the
+// current event. Contexts created from a Router look the event up in the
+// router's trie instead of trying every node in turn.
+func (c *Context) nextMatchingNode(from *HandlerNode) *HandlerNode {
+	if c.router == nil {
+		for node := from; node != nil; node = node.Next {
+			if node.tryMatch(c) {
+				return node
+			}
+		}
+
+		return nil
+	}
+
+	if from == nil {
+		return nil
+	}
+
+	for _, match := range c.routerMatches() {
+		if match.node.index >= from.index {
+			c.params = match.params
+			return match.node
+		}
+	}
+
+	return nil
+}
+
+func (c *Context) nodeMatches(node *HandlerNode) bool {
+	if c.router == nil {
+		return node.tryMatch(c)
+	}
+
+	for _, match := range c.routerMatches() {
+		if match.node == node {
+			c.params = match.params
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Context) routerMatches() []routeMatch {
+	event := c.Event()
+	if !c.routeMatched || c.routeEvent != event {
+		c.routeMatches = c.router.match(event)
+		c.routeEvent = event
+		c.routeMatched = true
+	}
+
+	return c.routeMatches
+}
+
 func execWithCtxRecovery(ctx *Context, fn func()) {
 	defer func() {
 		if maybeErr := recover(); maybeErr != nil {
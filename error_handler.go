@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorHandler is called when the handler chain of a message ends with
+// ctx.Error set, including panics recovered into ctx.Error and
+// ctx.ErrorStack
+type ErrorHandler func(ctx *Context, err error)
+
+// SetErrorHandler replaces DefaultErrorHandler for the server's messages
+func (s *Server) SetErrorHandler(handler ErrorHandler) {
+	s.errorHandler = handler
+}
+
+func WithErrorHandler(handler ErrorHandler) ServerOption {
+	return func(s *Server) {
+		s.SetErrorHandler(handler)
+	}
+}
+
+// DefaultErrorHandler replies to messages sent with an ID with err as an
+// Error. Panics and errors that AsError reports as internal are logged, with
+// the stack of panics, and reach the client without their message.
+func DefaultErrorHandler(ctx *Context, err error) {
+	var wsErr *Error
+	if ctx.ErrorStack != "" {
+		ctx.logger().WithError(err).WithField("stack", ctx.ErrorStack).Error("handler panicked")
+		err = NewError(CodeInternal, "internal error")
+	} else if !errors.As(err, &wsErr) && AsError(err).Code == CodeInternal {
+		ctx.logger().WithError(err).WithField("event", ctx.Event()).Error("handler failed")
+	}
+
+	if !ctx.HasMessageID() {
+		return
+	}
+
+	if replyErr := ctx.ReplyError(err); replyErr != nil && !errors.Is(replyErr, ErrSocketClosed) {
+		ctx.logger().WithError(replyErr).Error("failed to send error reply")
+	}
+}
+
+// ReplyError answers the message with err converted by AsError
+func (c *Context) ReplyError(err error) error {
+	if c.socket == nil {
+		return ErrContextFreed
+	}
+
+	if c.MessageID() == "" {
+		return ErrNoMessageID
+	}
+
+	msgBuf, marshalErr := c.marshallOutboundMessage(&OutboundMessage{
+		ID:    c.MessageID(),
+		Error: AsError(err),
+	})
+
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	return c.socket.Send(c.messageType, msgBuf)
+}
+
+// handleError runs the error handler once for a context whose chain ended
+// with an error
+func (s *Server) handleError(ctx *Context) {
+	if ctx.Error == nil || ctx.errorHandled {
+		return
+	}
+
+	ctx.errorHandled = true
+	handler := s.errorHandler
+	if handler == nil {
+		handler = DefaultErrorHandler
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.WithField("panic", r).Error("error handler panicked")
+		}
+	}()
+
+	handler(ctx, ctx.Error)
+}
+
+func (c *Context) logger() *logrus.Logger {
+	if c.socket != nil && c.socket.server != nil {
+		return c.socket.server.logger
+	}
+
+	return logrus.StandardLogger()
+}
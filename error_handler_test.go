@@ -0,0 +1,50 @@
+package websocket_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+func TestDefaultErrorHandlerReplies(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		err    error
+		want   ws.Error
+		logged bool
+	}{
+		{"ws error", ws.NewError(ws.CodeForbidden, "not yours"), ws.Error{Code: ws.CodeForbidden, Message: "not yours"}, false},
+		{"wrapped ws error", fmt.Errorf("loading: %w", ws.NewError(ws.CodeNotFound, "gone")), ws.Error{Code: ws.CodeNotFound, Message: "gone"}, false},
+		{"sentinel", fmt.Errorf("lobby: %w", ws.ErrRoomNotFound), ws.Error{Code: ws.CodeNotFound, Message: "lobby: " + ws.ErrRoomNotFound.Error()}, false},
+		{"plain error", errors.New("secret dsn postgres://admin:hunter2@db"), ws.Error{Code: ws.CodeInternal, Message: "internal error"}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := logrus.New()
+			logger.SetOutput(&logs)
+			server := newJSONServer(t, ws.WithLogger(logger))
+			on(t, server, "fail", func(ctx *ws.Context) {
+				ctx.Error = test.err
+			})
+
+			reply := wstest.NewClient(t, server).Request("fail", nil)
+			if reply.Error == nil || *reply.Error != test.want {
+				t.Fatalf("reply error = %+v, want %+v", reply.Error, test.want)
+			}
+
+			if test.logged && strings.Contains(string(reply.Raw), "secret") {
+				t.Fatalf("reply %s leaks the error", reply.Raw)
+			}
+
+			if logged := strings.Contains(logs.String(), test.err.Error()); logged != test.logged {
+				t.Fatalf("logged = %v, want %v: %s", logged, test.logged, logs.String())
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -16,7 +17,16 @@ var (
 	ErrInvalidSocketID = errors.New("invalid socket ID")
 	ErrSocketNotFound  = errors.New("socket not found")
 	ErrRoomNotFound    = errors.New("room not found")
+	ErrNotInRoom       = errors.New("socket is not in room")
 	ErrNoRoomManager   = errors.New("room manager not initialized")
+	ErrSocketClosed    = errors.New("socket closed")
+	ErrInvalidData     = errors.New("invalid message data")
+
+	ErrOutboundQueueFull = errors.New("outbound queue full")
+	// ErrSequentialRequest is returned by the Request methods of a context
+	// whose message is handled in SequentialProcessing mode: the socket would
+	// not read the reply before the handler returns.
+	ErrSequentialRequest = errors.New("cannot wait for a reply while handling a message sequentially")
 )
 
 type InvalidHandlerError struct {
@@ -40,3 +50,58 @@ func (e *InvalidPatternError) Error() string {
 func (e *InvalidPatternError) Unwrap() error {
 	return e.Reason
 }
+
+const (
+	CodeBadRequest   = "bad_request"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeTimeout      = "timeout"
+	CodeUnavailable  = "unavailable"
+	CodeInternal     = "internal"
+)
+
+// Error is the error reported to clients. Handlers set it as ctx.Error, or
+// return it from a Typed handler, to choose what the client sees.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// AsError converts err to the Error sent to clients. An *Error in the chain
+// of err is returned as is, and errors implementing As can convert
+// themselves; other errors get a code matching the sentinel they wrap, or
+// CodeInternal with a fixed message so internal details never reach
+// clients.
+func AsError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var wsErr *Error
+	if errors.As(err, &wsErr) {
+		return wsErr
+	}
+
+	switch {
+	case errors.Is(err, ErrInvalidData):
+		return NewError(CodeBadRequest, err.Error())
+	case errors.Is(err, ErrSocketNotFound), errors.Is(err, ErrRoomNotFound):
+		return NewError(CodeNotFound, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeTimeout, Message: err.Error(), Retryable: true}
+	default:
+		return NewError(CodeInternal, "internal error")
+	}
+}
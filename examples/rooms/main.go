@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	websocket "github.com/snapflowio/websocket"
 	"github.com/snapflowio/websocket/middleware/json"
@@ -22,12 +23,42 @@ type DirectMessage struct {
 	Message  string `json:"message"`
 }
 
+type MultiRoomMessage struct {
+	Rooms   []string `json:"rooms"`
+	Message string   `json:"message"`
+}
+
 func main() {
-	server := websocket.NewServer()
+	server := websocket.NewServer(
+		websocket.WithCodec(json.Codec()),
+		websocket.WithRoomAutoDelete(time.Minute),
+	)
+
 	if err := server.Use(json.Middleware()); err != nil {
 		log.Fatal(err)
 	}
 
+	rooms := server.Rooms()
+	rooms.OnJoin(func(room *websocket.Room, socket *websocket.Socket) {
+		log.Printf("Socket %s joined room: %s", socket.ID(), room.Name())
+		server.To(room.Name()).Except(socket.ID()).Emit("user_joined", map[string]string{
+			"room":     room.Name(),
+			"socketId": socket.ID(),
+		})
+	})
+
+	rooms.OnLeave(func(room *websocket.Room, socket *websocket.Socket) {
+		log.Printf("Socket %s left room: %s", socket.ID(), room.Name())
+		server.To(room.Name()).Emit("user_left", map[string]string{
+			"room":     room.Name(),
+			"socketId": socket.ID(),
+		})
+	})
+
+	rooms.OnRoomDelete(func(room *websocket.Room) {
+		log.Printf("Room %s deleted", room.Name())
+	})
+
 	if err := server.UseOpen(func(ctx *websocket.Context) {
 		log.Printf("Socket %s connected from %s", ctx.SocketID(), ctx.ConnectionInfo().RemoteAddr)
 	}); err != nil {
@@ -40,52 +71,27 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := server.On("join", func(ctx *websocket.Context) {
-		var msg JoinRoomMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal join message: %v", err)
-			return
-		}
-
+	if err := server.On("join", websocket.Typed(func(ctx *websocket.Context, msg JoinRoomMessage) (map[string]string, error) {
 		ctx.Join(msg.Room)
-		log.Printf("Socket %s joined room: %s", ctx.SocketID(), msg.Room)
-		ctx.To(msg.Room).Emit(map[string]string{
-			"event":    "user_joined",
-			"socketId": ctx.SocketID(),
-		})
-
-		ctx.Reply(map[string]any{
+		return map[string]string{
 			"status": "joined",
 			"room":   msg.Room,
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("leave", func(ctx *websocket.Context) {
-		var msg JoinRoomMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal leave message: %v", err)
-			return
-		}
-
+	if err := server.On("leave", websocket.Typed(func(ctx *websocket.Context, msg JoinRoomMessage) (map[string]string, error) {
 		ctx.Leave(msg.Room)
-		log.Printf("Socket %s left room: %s", ctx.SocketID(), msg.Room)
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "left",
 			"room":   msg.Room,
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("chat", func(ctx *websocket.Context) {
-		var msg ChatMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal chat message: %v", err)
-			return
-		}
-
+	if err := server.On("chat", websocket.Typed(func(ctx *websocket.Context, msg ChatMessage) (map[string]string, error) {
 		log.Printf("Broadcasting to room %s: %s", msg.Room, msg.Message)
 		count := ctx.To(msg.Room).Emit(map[string]string{
 			"message": msg.Message,
@@ -93,61 +99,42 @@ func main() {
 		})
 
 		log.Printf("Sent to %d sockets in room %s", count, msg.Room)
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "sent",
-		})
-
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("broadcast", func(ctx *websocket.Context) {
-		var msg ChatMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal broadcast message: %v", err)
-			return
-		}
-
+	if err := server.On("broadcast", websocket.Typed(func(ctx *websocket.Context, msg ChatMessage) (map[string]string, error) {
 		count := ctx.Broadcast(map[string]string{
 			"message": msg.Message,
 			"from":    ctx.SocketID(),
 		})
 
 		log.Printf("Broadcast sent to %d sockets", count)
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "broadcast_sent",
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("broadcast_except_me", func(ctx *websocket.Context) {
-		var msg ChatMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			return
-		}
-
+	if err := server.On("broadcast_except_me", websocket.Typed(func(ctx *websocket.Context, msg ChatMessage) (map[string]string, error) {
 		count := ctx.BroadcastExceptMe(map[string]string{
 			"message": msg.Message,
 			"from":    ctx.SocketID(),
 		})
 
 		log.Printf("Broadcast sent to %d other sockets", count)
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "broadcast_sent",
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("direct_message", func(ctx *websocket.Context) {
-		var msg DirectMessage
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal direct message: %v", err)
-			return
-		}
-
+	if err := server.On("direct_message", websocket.Typed(func(ctx *websocket.Context, msg DirectMessage) (map[string]string, error) {
 		err := ctx.EmitTo(msg.SocketID, map[string]string{
 			"message": msg.Message,
 			"from":    ctx.SocketID(),
@@ -155,41 +142,27 @@ func main() {
 
 		if err != nil {
 			log.Printf("Failed to send direct message: %v", err)
-			ctx.Reply(map[string]string{
-				"status": "error",
-				"error":  err.Error(),
-			})
-			return
+			return nil, err
 		}
 
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "sent",
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := server.On("multi_room_chat", func(ctx *websocket.Context) {
-		var msg struct {
-			Rooms   []string `json:"rooms"`
-			Message string   `json:"message"`
-		}
-
-		if err := ctx.Unmarshal(&msg); err != nil {
-			log.Printf("Failed to unmarshal multi-room message: %v", err)
-			return
-		}
-
+	if err := server.On("multi_room_chat", websocket.Typed(func(ctx *websocket.Context, msg MultiRoomMessage) (map[string]string, error) {
 		count := ctx.ToRooms(msg.Rooms...).Emit(map[string]string{
 			"message": msg.Message,
 			"from":    ctx.SocketID(),
 		})
 
 		log.Printf("Multi-room broadcast sent to %d sockets in rooms %v", count, msg.Rooms)
-		ctx.Reply(map[string]string{
+		return map[string]string{
 			"status": "sent",
-		})
-	}); err != nil {
+		}, nil
+	})); err != nil {
 		log.Fatal(err)
 	}
 
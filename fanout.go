@@ -0,0 +1,182 @@
+package websocket
+
+// fanout encodes a message sent to many sockets. Each socket gets the message
+// in the codec it uses, encoded once per codec. Sockets without a codec and
+// other nodes get the fallback encoding of the sender.
+type fanout struct {
+	message     *OutboundMessage
+	marshaller  func(message *OutboundMessage) ([]byte, error)
+	messageType MessageType
+	encoded     map[string]*encoding
+	fallback    *encoding
+}
+
+type encoding struct {
+	data        []byte
+	messageType MessageType
+	err         error
+}
+
+func newFanout(message *OutboundMessage, marshaller func(message *OutboundMessage) ([]byte, error), messageType MessageType) *fanout {
+	return &fanout{
+		message:     message,
+		marshaller:  marshaller,
+		messageType: messageType,
+		encoded:     map[string]*encoding{},
+	}
+}
+
+// fanout creates a fanout that falls back to the server's codec
+func (s *Server) fanout(message *OutboundMessage) *fanout {
+	if s.codec == nil {
+		return newFanout(message, nil, 0)
+	}
+
+	return newFanout(message, s.codec.Encode, s.codec.MessageType())
+}
+
+// fanout creates a fanout that falls back to the codec of the room manager's
+// server
+func (rm *RoomManager) fanout(message *OutboundMessage) *fanout {
+	rm.mu.RLock()
+	codec := rm.codec
+	rm.mu.RUnlock()
+	if codec == nil {
+		return newFanout(message, nil, 0)
+	}
+
+	return newFanout(message, codec.Encode, codec.MessageType())
+}
+
+// encodeFor returns the message encoded for socket
+func (f *fanout) encodeFor(socket *Socket) *encoding {
+	codec := socket.Codec()
+	if codec == nil {
+		return f.encodeFallback()
+	}
+
+	name := codec.Name()
+	if e, ok := f.encoded[name]; ok {
+		return e
+	}
+
+	e := &encoding{messageType: codec.MessageType()}
+	e.data, e.err = codec.Encode(f.copyMessage())
+	f.encoded[name] = e
+	return e
+}
+
+func (f *fanout) encodeFallback() *encoding {
+	if f.fallback != nil {
+		return f.fallback
+	}
+
+	f.fallback = &encoding{messageType: f.messageType}
+	if f.marshaller == nil {
+		f.fallback.err = ErrNoMarshaller
+	} else {
+		f.fallback.data, f.fallback.err = f.marshaller(f.copyMessage())
+	}
+
+	return f.fallback
+}
+
+// copyMessage returns a copy of the message for one codec. Codecs may rewrite
+// the message they encode, e.g. the json codec wraps string data.
+func (f *fanout) copyMessage() *OutboundMessage {
+	message := *f.message
+	return &message
+}
+
+// sendTo sends the message to socket in its own encoding
+func (f *fanout) sendTo(socket *Socket) error {
+	e := f.encodeFor(socket)
+	if e.err != nil {
+		return e.err
+	}
+
+	return socket.Send(e.messageType, e.data)
+}
+
+// deliver sends the message to the sockets not listed in msg.Except and
+// publishes the fallback encoding through the adapter of rm as msg. It
+// returns the number of local sockets the message was sent to.
+func (f *fanout) deliver(rm *RoomManager, sockets []*Socket, msg *AdapterMessage) int {
+	except := make(map[string]bool, len(msg.Except))
+	for _, id := range msg.Except {
+		except[id] = true
+	}
+
+	sent := f.sendToAll(rm, sockets, except)
+	if rm == nil {
+		return sent
+	}
+
+	if _, local := rm.Adapter().(*MemoryAdapter); local {
+		return sent
+	}
+
+	e := f.encodeFallback()
+	if e.err != nil {
+		if rm.logger != nil {
+			rm.logger.WithError(e.err).Warn("Failed to encode message for adapter")
+		}
+
+		return sent
+	}
+
+	msg.MessageType = e.messageType
+	msg.Data = e.data
+	rm.publish(msg)
+	return sent
+}
+
+// sendToAll sends the message to the sockets not in except, logging failures
+// with the logger of rm. It returns the number of sockets it reached.
+func (f *fanout) sendToAll(rm *RoomManager, sockets []*Socket, except map[string]bool) int {
+	sent := 0
+	for _, socket := range sockets {
+		if except[socket.ID()] {
+			continue
+		}
+
+		if err := f.sendTo(socket); err != nil {
+			if rm != nil && rm.logger != nil {
+				rm.logger.WithError(err).WithField("socketId", socket.ID()).Warn("Failed to send to socket")
+			}
+
+			continue
+		}
+
+		sent++
+	}
+
+	return sent
+}
+
+// publishTo sends the fallback encoding to a socket connected to another node
+func (f *fanout) publishTo(rm *RoomManager, socketID string) error {
+	remoteSockets, err := rm.RemoteSockets("")
+	if err != nil {
+		return err
+	}
+
+	for _, id := range remoteSockets {
+		if id != socketID {
+			continue
+		}
+
+		e := f.encodeFallback()
+		if e.err != nil {
+			return e.err
+		}
+
+		return rm.Adapter().Publish(&AdapterMessage{
+			SocketID:    socketID,
+			MessageType: e.messageType,
+			Data:        e.data,
+		})
+	}
+
+	return ErrSocketNotFound
+}
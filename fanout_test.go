@@ -0,0 +1,50 @@
+package websocket_test
+
+import (
+	"testing"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/msgpack"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+func TestFanoutEncodesPerCodec(t *testing.T) {
+	server := newJSONServer(t)
+	jsonClient := wstest.NewClient(t, server)
+	msgpackClient := wstest.NewClient(t, server)
+	msgpackClient.Socket().SetCodec(msgpack.Codec())
+
+	// Sockets are visited in no particular order, so emit a few times for
+	// the json codec to encode first at least once
+	for range 10 {
+		if sent := server.Emit("news", "hello"); sent != 2 {
+			t.Fatalf("Emit reached %d sockets, want 2", sent)
+		}
+
+		var wrapped struct {
+			Message string `json:"message"`
+		}
+
+		if err := jsonClient.ExpectEvent("news").Unmarshal(&wrapped); err != nil || wrapped.Message != "hello" {
+			t.Fatalf("json client got %+v, %v", wrapped, err)
+		}
+
+		msg := msgpackClient.Receive()
+		if msg.Type != ws.MessageBinary {
+			t.Fatalf("msgpack client got a %v message", msg.Type)
+		}
+
+		var envelope struct {
+			Event string `json:"event"`
+			Data  any    `json:"data"`
+		}
+
+		if err := msgpack.Unmarshal(msg.Raw, &envelope); err != nil {
+			t.Fatal(err)
+		}
+
+		if envelope.Event != "news" || envelope.Data != "hello" {
+			t.Fatalf("msgpack client got %+v, want the unwrapped string", envelope)
+		}
+	}
+}
@@ -23,12 +23,19 @@ type HandlerNode struct {
 	Pattern  *Pattern
 	Handlers []any
 	Next     *HandlerNode
+	index    int
 }
 
 func (n *HandlerNode) tryMatch(ctx *Context) bool {
 	if n.Pattern == nil {
+		ctx.params = nil
 		return true
 	}
 
-	return n.Pattern.Match(ctx.Event())
+	params, ok := n.Pattern.MatchParams(ctx.Event())
+	if ok {
+		ctx.params = params
+	}
+
+	return ok
 }
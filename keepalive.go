@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// Pinger is implemented by connections that can send a ping and wait for the
+// client's pong. Keepalive pings are only sent on such connections.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+var _ Pinger = &WebSocketConnection{}
+
+func (c *WebSocketConnection) Ping(ctx context.Context) error {
+	return c.conn.Ping(ctx)
+}
+
+// SetKeepalive makes the server ping every socket each interval. A socket
+// that does not answer within pongTimeout is dropped with
+// StatusPolicyViolation as its close status. A zero pongTimeout waits for a
+// whole interval and a zero interval disables pings.
+func (s *Server) SetKeepalive(interval, pongTimeout time.Duration) {
+	s.pingInterval = interval
+	s.pongTimeout = pongTimeout
+}
+
+// SetIdleTimeout closes sockets that have not sent a message for the given
+// duration with StatusPolicyViolation. Pongs do not count as messages. Zero
+// disables the timeout.
+func (s *Server) SetIdleTimeout(timeout time.Duration) {
+	s.idleTimeout = timeout
+}
+
+func WithPingInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pingInterval = interval
+	}
+}
+
+func WithPongTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.pongTimeout = timeout
+	}
+}
+
+func WithIdleTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.SetIdleTimeout(timeout)
+	}
+}
+
+// Latency returns the round trip time of the last keepalive ping, or zero if
+// none has been answered yet.
+func (s *Socket) Latency() time.Duration {
+	return time.Duration(s.latency.Load())
+}
+
+func (s *Socket) touch() {
+	s.lastRead.Store(time.Now().UnixNano())
+}
+
+func (s *Socket) idleFor() time.Duration {
+	return time.Since(time.Unix(0, s.lastRead.Load()))
+}
+
+// keepalive pings the client and enforces the idle timeout until the socket
+// is closed.
+func (s *Socket) keepalive(interval, pongTimeout, idleTimeout time.Duration) {
+	pinger, ok := s.connection.(Pinger)
+	if !ok {
+		interval = 0
+	}
+
+	if interval <= 0 && idleTimeout <= 0 {
+		return
+	}
+
+	if pongTimeout <= 0 {
+		pongTimeout = interval
+	}
+
+	var pings <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if idleTimeout > 0 {
+		idleTimer = time.NewTimer(idleTimeout)
+		defer idleTimer.Stop()
+		idle = idleTimer.C
+	}
+
+	for {
+		select {
+		case <-s.Done():
+			return
+		case <-pings:
+			if !s.ping(pinger, pongTimeout) {
+				return
+			}
+		case <-idle:
+			remaining := idleTimeout - s.idleFor()
+			if remaining <= 0 {
+				s.Close(StatusPolicyViolation, "idle timeout", ServerCloseSource)
+				return
+			}
+
+			idleTimer.Reset(remaining)
+		}
+	}
+}
+
+func (s *Socket) ping(pinger Pinger, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	if err := pinger.Ping(ctx); err != nil {
+		s.terminate(StatusPolicyViolation, "pong timeout")
+		return false
+	}
+
+	s.latency.Store(int64(time.Since(start)))
+	return true
+}
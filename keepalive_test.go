@@ -0,0 +1,157 @@
+package websocket_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+// handle serves conn on server and waits until its socket is registered.
+// The connection is closed when the test ends.
+func handle(t *testing.T, server *ws.Server, conn ws.SocketConnection) *ws.Socket {
+	t.Helper()
+	info := &ws.ConnectionInfo{RemoteAddr: "pipe"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.HandleConnection(info, conn)
+	}()
+
+	t.Cleanup(func() {
+		conn.Close(ws.StatusNormalClosure, "")
+		<-done
+	})
+
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, socket := range server.Sockets() {
+			if socket.ConnectionInfo() == info {
+				return socket
+			}
+		}
+	}
+
+	t.Fatal("server did not register the socket")
+	return nil
+}
+
+type closeStatus struct {
+	status ws.Status
+	reason string
+}
+
+// closeStatuses reports the close status of every socket of server
+func closeStatuses(t *testing.T, server *ws.Server) <-chan closeStatus {
+	t.Helper()
+	statuses := make(chan closeStatus, 1)
+	if err := server.UseClose(func(ctx *ws.Context) {
+		status, reason, _ := ctx.CloseStatus()
+		statuses <- closeStatus{status, reason}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return statuses
+}
+
+// pingConn counts pings and answers them unless silent is set
+type pingConn struct {
+	*wstest.Conn
+	pings  atomic.Int32
+	silent bool
+}
+
+func (c *pingConn) Ping(ctx context.Context) error {
+	c.pings.Add(1)
+	if c.silent {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	return c.Conn.Ping(ctx)
+}
+
+func TestKeepalivePings(t *testing.T) {
+	server := newJSONServer(t, ws.WithPingInterval(10*time.Millisecond))
+	serverConn, _ := wstest.Pipe()
+	conn := &pingConn{Conn: serverConn}
+	socket := handle(t, server, conn)
+
+	deadline := time.Now().Add(time.Second)
+	for conn.pings.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d pings sent within a second, want 3", conn.pings.Load())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if socket.IsClosed() {
+		t.Fatal("socket answering pings was closed")
+	}
+}
+
+func TestKeepaliveDisabledByDefault(t *testing.T) {
+	serverConn, _ := wstest.Pipe()
+	conn := &pingConn{Conn: serverConn}
+	handle(t, newJSONServer(t), conn)
+	time.Sleep(30 * time.Millisecond)
+	if pings := conn.pings.Load(); pings != 0 {
+		t.Fatalf("%d pings sent without keepalive", pings)
+	}
+}
+
+func TestPongTimeout(t *testing.T) {
+	server := newJSONServer(t,
+		ws.WithPingInterval(10*time.Millisecond),
+		ws.WithPongTimeout(20*time.Millisecond),
+	)
+	statuses := closeStatuses(t, server)
+	serverConn, clientConn := wstest.Pipe()
+	socket := handle(t, server, &pingConn{Conn: serverConn, silent: true})
+
+	select {
+	case <-socket.Done():
+	case <-time.After(time.Second):
+		t.Fatal("socket not answering pings was not closed")
+	}
+
+	want := closeStatus{ws.StatusPolicyViolation, "pong timeout"}
+	if got := <-statuses; got != want {
+		t.Fatalf("close status = %+v, want %+v", got, want)
+	}
+
+	if status := clientConn.CloseStatus(); status != ws.StatusPolicyViolation {
+		t.Fatalf("connection closed with %d, want %d", status, ws.StatusPolicyViolation)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	// Pongs do not keep an idle socket open
+	server := newJSONServer(t,
+		ws.WithIdleTimeout(50*time.Millisecond),
+		ws.WithPingInterval(10*time.Millisecond),
+	)
+	statuses := closeStatuses(t, server)
+	on(t, server, "tick", func(ctx *ws.Context) {})
+	client := wstest.NewClient(t, server)
+
+	// Messages reset the timeout
+	for range 5 {
+		client.Emit("tick", nil)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if client.Socket().IsClosed() {
+		t.Fatal("active socket was closed")
+	}
+
+	client.ExpectClosed(ws.StatusPolicyViolation)
+	want := closeStatus{ws.StatusPolicyViolation, "idle timeout"}
+	if got := <-statuses; got != want {
+		t.Fatalf("close status = %+v, want %+v", got, want)
+	}
+}
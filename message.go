@@ -5,6 +5,7 @@ import "sync"
 type InboundMessage struct {
 	hasSetID    bool
 	hasSetEvent bool
+	hasClientID bool
 	ID          string
 	Event       string
 	RawData     []byte
@@ -22,6 +23,7 @@ func inboundMessageFromPool() *InboundMessage {
 	msg := inboundMessagePool.Get().(*InboundMessage)
 	msg.hasSetID = false
 	msg.hasSetEvent = false
+	msg.hasClientID = false
 	msg.ID = ""
 	msg.Event = ""
 	msg.RawData = nil
@@ -37,4 +39,5 @@ type OutboundMessage struct {
 	ID    string
 	Event string
 	Data  any
+	Error *Error
 }
@@ -0,0 +1,42 @@
+package json
+
+import (
+	"bytes"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+const Subprotocol = "json"
+
+type codec struct{}
+
+// Codec returns the json envelope codec for websocket.Negotiate. It sniffs
+// text frames holding a JSON object.
+func Codec() websocket.Codec {
+	return codec{}
+}
+
+func (codec) Name() string {
+	return Subprotocol
+}
+
+func (codec) Decode(raw []byte) (*websocket.Envelope, error) {
+	return decode(raw)
+}
+
+func (codec) Unmarshal(message *websocket.InboundMessage, into any) error {
+	return unmarshal(message, into)
+}
+
+func (codec) Encode(message *websocket.OutboundMessage) ([]byte, error) {
+	return Marshal(message)
+}
+
+func (codec) MessageType() websocket.MessageType {
+	return websocket.MessageText
+}
+
+func (codec) Sniff(messageType websocket.MessageType, raw []byte) bool {
+	raw = bytes.TrimLeft(raw, " \t\r\n")
+	return messageType == websocket.MessageText && len(raw) > 0 && raw[0] == '{'
+}
@@ -9,22 +9,25 @@ import (
 
 func Middleware() func(ctx *websocket.Context) {
 	return func(ctx *websocket.Context) {
-		headers := ctx.Headers()
-		secWebSocketProtocol := headers.Get("Sec-WebSocket-Protocol")
-
-		if secWebSocketProtocol != "" && secWebSocketProtocol != "json" {
-			ctx.Error = errors.New("Unsupported WebSocket Subprotocol: " + secWebSocketProtocol)
+		secWebSocketProtocol := ctx.Subprotocol()
+		if secWebSocketProtocol != "" && secWebSocketProtocol != Subprotocol {
+			// The server negotiated another subprotocol, which is left to the
+			// middleware handling it
+			ctx.Next()
 			return
 		}
 
-		var messageData struct {
-			ID    string          `json:"id"`
-			Event string          `json:"event"`
-			Meta  map[string]any  `json:"meta"`
-			Data  json.RawMessage `json:"data"`
+		if secWebSocketProtocol == "" {
+			secWebSocketProtocol = ctx.Headers().Get("Sec-WebSocket-Protocol")
+		}
+
+		if secWebSocketProtocol != "" && secWebSocketProtocol != Subprotocol {
+			ctx.Error = errors.New("Unsupported WebSocket Subprotocol: " + secWebSocketProtocol)
+			return
 		}
 
-		if err := json.Unmarshal(ctx.RawData(), &messageData); err != nil {
+		messageData, err := decode(ctx.RawData())
+		if err != nil {
 			if secWebSocketProtocol == "" {
 				ctx.Next()
 				return
@@ -49,44 +52,82 @@ func Middleware() func(ctx *websocket.Context) {
 			ctx.SetMessageData(messageData.Data)
 		}
 
-		ctx.SetMessageUnmarshaler(func(message *websocket.InboundMessage, into any) error {
-			return json.Unmarshal(message.Data, into)
-		})
-
-		ctx.SetMessageMarshaller(func(message *websocket.OutboundMessage) ([]byte, error) {
-			switch v := message.Data.(type) {
-			case []FieldError:
-				message.Data = M{
-					"error":  "Validation error",
-					"fields": genFieldsField(v),
-				}
-			case FieldError:
-				message.Data = M{
-					"error":  "Validation error",
-					"fields": genFieldsField([]FieldError{v}),
-				}
-			case Error:
-				message.Data = M{"error": string(v)}
-			case string:
-				message.Data = M{"message": v}
-			}
+		ctx.Socket().SetCodec(Codec())
+		ctx.SetMessageUnmarshaler(unmarshal)
+		ctx.SetMessageMarshaller(Marshal)
+		ctx.Next()
+	}
+}
 
-			envelope := map[string]any{}
-			if message.ID != "" {
-				envelope["id"] = message.ID
-			}
+func decode(raw []byte) (*websocket.Envelope, error) {
+	var messageData struct {
+		ID    string          `json:"id"`
+		Event string          `json:"event"`
+		Meta  map[string]any  `json:"meta"`
+		Data  json.RawMessage `json:"data"`
+	}
 
-			if message.Event != "" {
-				envelope["event"] = message.Event
-			}
+	if err := json.Unmarshal(raw, &messageData); err != nil {
+		return nil, err
+	}
 
-			if message.Data != nil {
-				envelope["data"] = message.Data
-			}
+	return &websocket.Envelope{
+		ID:    messageData.ID,
+		Event: messageData.Event,
+		Meta:  messageData.Meta,
+		Data:  messageData.Data,
+	}, nil
+}
 
-			return json.Marshal(envelope)
-		})
+func unmarshal(message *websocket.InboundMessage, into any) error {
+	return json.Unmarshal(message.Data, into)
+}
 
-		ctx.Next()
+// Marshal encodes an outbound message as a json envelope
+func Marshal(message *websocket.OutboundMessage) ([]byte, error) {
+	if err, ok := message.Data.(*websocket.Error); ok && message.Error == nil {
+		message.Data = nil
+		message.Error = err
+	}
+
+	switch v := message.Data.(type) {
+	case interface{ FieldErrors() []FieldError }:
+		message.Data = M{
+			"error":  "Validation error",
+			"fields": genFieldsField(v.FieldErrors()),
+		}
+	case []FieldError:
+		message.Data = M{
+			"error":  "Validation error",
+			"fields": genFieldsField(v),
+		}
+	case FieldError:
+		message.Data = M{
+			"error":  "Validation error",
+			"fields": genFieldsField([]FieldError{v}),
+		}
+	case Error:
+		message.Data = M{"error": string(v)}
+	case string:
+		message.Data = M{"message": v}
+	}
+
+	envelope := map[string]any{}
+	if message.ID != "" {
+		envelope["id"] = message.ID
+	}
+
+	if message.Event != "" {
+		envelope["event"] = message.Event
+	}
+
+	if message.Data != nil {
+		envelope["data"] = message.Data
+	}
+
+	if message.Error != nil {
+		envelope["error"] = message.Error
 	}
+
+	return json.Marshal(envelope)
 }
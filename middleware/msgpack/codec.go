@@ -0,0 +1,40 @@
+package msgpack
+
+import websocket "github.com/snapflowio/websocket"
+
+type codec struct{}
+
+// Codec returns the msgpack envelope codec for websocket.Negotiate. It
+// sniffs binary frames starting with a msgpack map.
+func Codec() websocket.Codec {
+	return codec{}
+}
+
+func (codec) Name() string {
+	return Subprotocol
+}
+
+func (codec) Decode(raw []byte) (*websocket.Envelope, error) {
+	return decode(raw)
+}
+
+func (codec) Unmarshal(message *websocket.InboundMessage, into any) error {
+	return unmarshal(message, into)
+}
+
+func (codec) Encode(message *websocket.OutboundMessage) ([]byte, error) {
+	return Marshal(message)
+}
+
+func (codec) MessageType() websocket.MessageType {
+	return websocket.MessageBinary
+}
+
+func (codec) Sniff(messageType websocket.MessageType, raw []byte) bool {
+	if messageType != websocket.MessageBinary || len(raw) == 0 {
+		return false
+	}
+
+	// fixmap, map 16 and map 32
+	return raw[0]&0xf0 == 0x80 || raw[0] == 0xde || raw[0] == 0xdf
+}
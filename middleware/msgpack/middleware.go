@@ -0,0 +1,136 @@
+// Package msgpack decodes and encodes messages as MessagePack for clients
+// that negotiate the "msgpack" subprotocol. It uses the same envelope as the
+// json middleware, with id, event, meta and data fields, and sends every
+// message as a binary frame.
+package msgpack
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+const Subprotocol = "msgpack"
+
+// Middleware handles messages of connections using the msgpack subprotocol
+// and passes every other message on untouched, so it can be used together
+// with the json middleware:
+//
+//	server := websocket.NewServer(websocket.WithSubprotocols("msgpack", "json"))
+//	server.Use(msgpack.Middleware())
+//	server.Use(json.Middleware())
+func Middleware() func(ctx *websocket.Context) {
+	return func(ctx *websocket.Context) {
+		secWebSocketProtocol := ctx.Subprotocol()
+		if secWebSocketProtocol == "" {
+			secWebSocketProtocol = ctx.Headers().Get("Sec-WebSocket-Protocol")
+		}
+
+		if secWebSocketProtocol != Subprotocol {
+			ctx.Next()
+			return
+		}
+
+		messageData, err := decode(ctx.RawData())
+		if err != nil {
+			ctx.Error = err
+			return
+		}
+
+		if messageData.ID != "" {
+			ctx.SetMessageID(messageData.ID)
+		}
+
+		if messageData.Event != "" {
+			ctx.SetMessageEvent(messageData.Event)
+		}
+
+		if messageData.Meta != nil {
+			ctx.SetMessageMeta(messageData.Meta)
+		}
+
+		if messageData.Data != nil {
+			ctx.SetMessageData(messageData.Data)
+		}
+
+		ctx.SetMessageType(websocket.MessageBinary)
+		ctx.Socket().SetCodec(Codec())
+		ctx.SetMessageUnmarshaler(unmarshal)
+		ctx.SetMessageMarshaller(Marshal)
+		ctx.Next()
+	}
+}
+
+func decode(raw []byte) (*websocket.Envelope, error) {
+	var messageData struct {
+		ID    string             `msgpack:"id"`
+		Event string             `msgpack:"event"`
+		Meta  map[string]any     `msgpack:"meta"`
+		Data  msgpack.RawMessage `msgpack:"data"`
+	}
+
+	if err := Unmarshal(raw, &messageData); err != nil {
+		return nil, err
+	}
+
+	return &websocket.Envelope{
+		ID:    messageData.ID,
+		Event: messageData.Event,
+		Meta:  messageData.Meta,
+		Data:  messageData.Data,
+	}, nil
+}
+
+func unmarshal(message *websocket.InboundMessage, into any) error {
+	if len(message.Data) == 0 {
+		return errors.New("message has no data")
+	}
+
+	return Unmarshal(message.Data, into)
+}
+
+// Marshal encodes an outbound message as a msgpack envelope. Struct fields
+// without a msgpack tag use their json tag.
+func Marshal(message *websocket.OutboundMessage) ([]byte, error) {
+	if err, ok := message.Data.(*websocket.Error); ok && message.Error == nil {
+		message.Data = nil
+		message.Error = err
+	}
+
+	envelope := map[string]any{}
+	if message.ID != "" {
+		envelope["id"] = message.ID
+	}
+
+	if message.Event != "" {
+		envelope["event"] = message.Event
+	}
+
+	if message.Data != nil {
+		envelope["data"] = message.Data
+	}
+
+	if message.Error != nil {
+		envelope["error"] = message.Error
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(envelope); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes msgpack data into v. Struct fields without a msgpack tag
+// use their json tag, so the same types work with both middlewares.
+func Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
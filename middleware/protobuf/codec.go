@@ -0,0 +1,33 @@
+package protobuf
+
+import websocket "github.com/snapflowio/websocket"
+
+type codec struct {
+	registry *Registry
+}
+
+// Codec returns the protobuf envelope codec for websocket.Negotiate. It
+// does not sniff messages, so clients have to negotiate the subprotocol.
+func Codec(registry *Registry) websocket.Codec {
+	return &codec{registry: registry}
+}
+
+func (c *codec) Name() string {
+	return Subprotocol
+}
+
+func (c *codec) Decode(raw []byte) (*websocket.Envelope, error) {
+	return decode(raw)
+}
+
+func (c *codec) Unmarshal(message *websocket.InboundMessage, into any) error {
+	return unmarshalData(c.registry, message, into)
+}
+
+func (c *codec) Encode(message *websocket.OutboundMessage) ([]byte, error) {
+	return Marshal(message)
+}
+
+func (c *codec) MessageType() websocket.MessageType {
+	return websocket.MessageBinary
+}
@@ -0,0 +1,230 @@
+package protobuf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+// Envelope mirrors the Envelope message of envelope.proto. It is encoded by
+// hand so the package needs no generated code. Go clients can use it to
+// talk to the server.
+type Envelope struct {
+	ID    string
+	Event string
+	Meta  *structpb.Struct
+	Data  *anypb.Any
+	Error *websocket.Error
+}
+
+const (
+	fieldID    protowire.Number = 1
+	fieldEvent protowire.Number = 2
+	fieldMeta  protowire.Number = 3
+	fieldData  protowire.Number = 4
+	fieldError protowire.Number = 5
+
+	fieldErrorCode      protowire.Number = 1
+	fieldErrorMessage   protowire.Number = 2
+	fieldErrorDetails   protowire.Number = 3
+	fieldErrorRetryable protowire.Number = 4
+)
+
+func (e *Envelope) Marshal() ([]byte, error) {
+	var b []byte
+	b = appendString(b, fieldID, e.ID)
+	b = appendString(b, fieldEvent, e.Event)
+	if e.Meta != nil {
+		meta, err := proto.Marshal(e.Meta)
+		if err != nil {
+			return nil, err
+		}
+
+		b = appendBytes(b, fieldMeta, meta)
+	}
+
+	if e.Data != nil {
+		data, err := proto.Marshal(e.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		b = appendBytes(b, fieldData, data)
+	}
+
+	if e.Error != nil {
+		errBuf, err := marshalError(e.Error)
+		if err != nil {
+			return nil, err
+		}
+
+		b = appendBytes(b, fieldError, errBuf)
+	}
+
+	return b, nil
+}
+
+func marshalError(wsErr *websocket.Error) ([]byte, error) {
+	var b []byte
+	b = appendString(b, fieldErrorCode, wsErr.Code)
+	b = appendString(b, fieldErrorMessage, wsErr.Message)
+	if wsErr.Details != nil {
+		details, err := toValue(wsErr.Details)
+		if err != nil {
+			return nil, err
+		}
+
+		buf, err := proto.Marshal(details)
+		if err != nil {
+			return nil, err
+		}
+
+		b = appendBytes(b, fieldErrorDetails, buf)
+	}
+
+	if wsErr.Retryable {
+		b = protowire.AppendTag(b, fieldErrorRetryable, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+
+	return b, nil
+}
+
+func (e *Envelope) Unmarshal(b []byte) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+
+			b = b[n:]
+			continue
+		}
+
+		value, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+
+		b = b[n:]
+		switch num {
+		case fieldID:
+			e.ID = string(value)
+		case fieldEvent:
+			e.Event = string(value)
+		case fieldMeta:
+			e.Meta = &structpb.Struct{}
+			if err := proto.Unmarshal(value, e.Meta); err != nil {
+				return fmt.Errorf("invalid meta: %w", err)
+			}
+		case fieldData:
+			e.Data = &anypb.Any{}
+			if err := proto.Unmarshal(value, e.Data); err != nil {
+				return fmt.Errorf("invalid data: %w", err)
+			}
+		case fieldError:
+			wsErr, err := unmarshalError(value)
+			if err != nil {
+				return fmt.Errorf("invalid error: %w", err)
+			}
+
+			e.Error = wsErr
+		}
+	}
+
+	return nil
+}
+
+func unmarshalError(b []byte) (*websocket.Error, error) {
+	wsErr := &websocket.Error{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+
+		b = b[n:]
+		switch {
+		case num == fieldErrorRetryable && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			wsErr.Retryable = v != 0
+			b = b[n:]
+		case typ == protowire.BytesType:
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			b = b[n:]
+			switch num {
+			case fieldErrorCode:
+				wsErr.Code = string(value)
+			case fieldErrorMessage:
+				wsErr.Message = string(value)
+			case fieldErrorDetails:
+				details := &structpb.Value{}
+				if err := proto.Unmarshal(value, details); err != nil {
+					return nil, err
+				}
+
+				wsErr.Details = details.AsInterface()
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+
+			b = b[n:]
+		}
+	}
+
+	return wsErr, nil
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// toValue converts plain Go data to a google.protobuf.Value through its JSON
+// form
+func toValue(v any) (*structpb.Value, error) {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	value := &structpb.Value{}
+	if err := value.UnmarshalJSON(buf); err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
@@ -0,0 +1,330 @@
+package protobuf_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	websocket "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/protobuf"
+)
+
+// envelopeDescriptor builds the Envelope message of envelope.proto, so the
+// hand written encoding can be checked against proto.Marshal
+func envelopeDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+
+		return f
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("envelope.proto"),
+		Package:    proto.String("snapflow.websocket"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/any.proto", "google/protobuf/struct.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Envelope"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("event", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("meta", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Struct"),
+					field("data", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Any"),
+					field("error", 5, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".snapflow.websocket.Error"),
+				},
+			},
+			{
+				Name: proto.String("Error"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("code", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("message", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("details", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".google.protobuf.Value"),
+					field("retryable", 4, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+				},
+			},
+		},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("failed to build envelope.proto: %v", err)
+	}
+
+	return file.Messages().ByName("Envelope")
+}
+
+// dynamicEnvelope builds the message proto.Marshal encodes for env
+func dynamicEnvelope(t *testing.T, desc protoreflect.MessageDescriptor, env *protobuf.Envelope) proto.Message {
+	t.Helper()
+	msg := dynamicpb.NewMessage(desc)
+	fields := desc.Fields()
+	if env.ID != "" {
+		msg.Set(fields.ByName("id"), protoreflect.ValueOfString(env.ID))
+	}
+
+	if env.Event != "" {
+		msg.Set(fields.ByName("event"), protoreflect.ValueOfString(env.Event))
+	}
+
+	if env.Meta != nil {
+		msg.Set(fields.ByName("meta"), protoreflect.ValueOfMessage(env.Meta.ProtoReflect()))
+	}
+
+	if env.Data != nil {
+		msg.Set(fields.ByName("data"), protoreflect.ValueOfMessage(env.Data.ProtoReflect()))
+	}
+
+	if env.Error != nil {
+		errField := fields.ByName("error")
+		errMsg := dynamicpb.NewMessage(errField.Message())
+		errFields := errField.Message().Fields()
+		if env.Error.Code != "" {
+			errMsg.Set(errFields.ByName("code"), protoreflect.ValueOfString(env.Error.Code))
+		}
+
+		if env.Error.Message != "" {
+			errMsg.Set(errFields.ByName("message"), protoreflect.ValueOfString(env.Error.Message))
+		}
+
+		if env.Error.Details != nil {
+			details, err := structpb.NewValue(env.Error.Details)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errMsg.Set(errFields.ByName("details"), protoreflect.ValueOfMessage(details.ProtoReflect()))
+		}
+
+		if env.Error.Retryable {
+			errMsg.Set(errFields.ByName("retryable"), protoreflect.ValueOfBool(true))
+		}
+
+		msg.Set(errField, protoreflect.ValueOfMessage(errMsg))
+	}
+
+	return msg
+}
+
+func mustAny(t *testing.T, msg proto.Message) *anypb.Any {
+	t.Helper()
+	data, err := anypb.New(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func mustStruct(t *testing.T, fields map[string]any) *structpb.Struct {
+	t.Helper()
+	s, err := structpb.NewStruct(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func envelopes(t *testing.T) []struct {
+	name string
+	env  *protobuf.Envelope
+} {
+	// Meta holds a single key: proto.Marshal does not order map entries
+	return []struct {
+		name string
+		env  *protobuf.Envelope
+	}{
+		{"empty", &protobuf.Envelope{}},
+		{"id", &protobuf.Envelope{ID: "42"}},
+		{"event", &protobuf.Envelope{Event: "chat.send"}},
+		{"empty meta", &protobuf.Envelope{Meta: &structpb.Struct{}}},
+		{"meta", &protobuf.Envelope{Meta: mustStruct(t, map[string]any{"trace": "abc"})}},
+		{"data", &protobuf.Envelope{Data: mustAny(t, structpb.NewStringValue("hello"))}},
+		{"empty data", &protobuf.Envelope{Data: &anypb.Any{}}},
+		{"empty error", &protobuf.Envelope{Error: &websocket.Error{}}},
+		{"error", &protobuf.Envelope{ID: "1", Error: &websocket.Error{Code: websocket.CodeNotFound, Message: "no such room"}}},
+		{"error details", &protobuf.Envelope{Error: &websocket.Error{
+			Code:      websocket.CodeUnavailable,
+			Details:   []any{map[string]any{"field": "name"}, "later", 3.5, true},
+			Retryable: true,
+		}}},
+		{"every field", &protobuf.Envelope{
+			ID:    "7",
+			Event: "room.join",
+			Meta:  mustStruct(t, map[string]any{"attempt": 2.0}),
+			Data:  mustAny(t, mustStruct(t, map[string]any{"room": "lobby"})),
+			Error: &websocket.Error{Code: websocket.CodeTimeout, Message: "too slow", Retryable: true},
+		}},
+	}
+}
+
+func checkEnvelope(t *testing.T, got, want *protobuf.Envelope) {
+	t.Helper()
+	if got.ID != want.ID || got.Event != want.Event {
+		t.Errorf("id, event = %q, %q, want %q, %q", got.ID, got.Event, want.ID, want.Event)
+	}
+
+	if (got.Meta == nil) != (want.Meta == nil) || !proto.Equal(got.Meta, want.Meta) {
+		t.Errorf("meta = %v, want %v", got.Meta, want.Meta)
+	}
+
+	if (got.Data == nil) != (want.Data == nil) || !proto.Equal(got.Data, want.Data) {
+		t.Errorf("data = %v, want %v", got.Data, want.Data)
+	}
+
+	if !reflect.DeepEqual(got.Error, want.Error) {
+		t.Errorf("error = %#v, want %#v", got.Error, want.Error)
+	}
+}
+
+func TestEnvelopeMatchesProtoMarshal(t *testing.T) {
+	desc := envelopeDescriptor(t)
+	for _, test := range envelopes(t) {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.env.Marshal()
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			want, err := proto.MarshalOptions{Deterministic: true}.Marshal(dynamicEnvelope(t, desc, test.env))
+			if err != nil {
+				t.Fatalf("proto.Marshal: %v", err)
+			}
+
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Marshal = %x, proto.Marshal = %x", got, want)
+			}
+
+			var decoded protobuf.Envelope
+			if err := decoded.Unmarshal(got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			checkEnvelope(t, &decoded, test.env)
+		})
+	}
+}
+
+func TestEnvelopeDecodesProtoMarshal(t *testing.T) {
+	want := &protobuf.Envelope{
+		ID:    "3",
+		Event: "room.leave",
+		Meta:  mustStruct(t, map[string]any{"a": 1.0, "b": "two", "c": []any{true, nil}}),
+		Data:  mustAny(t, structpb.NewNumberValue(9)),
+		Error: &websocket.Error{Code: "custom", Details: map[string]any{"x": "y", "z": 1.0}},
+	}
+
+	raw, err := proto.Marshal(dynamicEnvelope(t, envelopeDescriptor(t), want))
+	if err != nil {
+		t.Fatalf("proto.Marshal: %v", err)
+	}
+
+	var got protobuf.Envelope
+	if err := got.Unmarshal(raw); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	checkEnvelope(t, &got, want)
+}
+
+func TestEnvelopeSkipsUnknownFields(t *testing.T) {
+	want := &protobuf.Envelope{ID: "1", Event: "e", Error: &websocket.Error{Code: "c", Retryable: true}}
+	unknown := func(b []byte) []byte {
+		b = protowire.AppendTag(b, 9, protowire.VarintType)
+		b = protowire.AppendVarint(b, 300)
+		b = protowire.AppendTag(b, 10, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, 1)
+		b = protowire.AppendTag(b, 11, protowire.BytesType)
+		b = protowire.AppendString(b, "ignored")
+		b = protowire.AppendTag(b, 12, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, 1)
+		// A known field number with an unexpected wire type is skipped too
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		return protowire.AppendVarint(b, 1)
+	}
+
+	var errBuf []byte
+	errBuf = unknown(errBuf)
+	errBuf = protowire.AppendTag(errBuf, 1, protowire.BytesType)
+	errBuf = protowire.AppendString(errBuf, "c")
+	errBuf = protowire.AppendTag(errBuf, 4, protowire.VarintType)
+	errBuf = protowire.AppendVarint(errBuf, 1)
+
+	var raw []byte
+	raw = unknown(raw)
+	raw = protowire.AppendTag(raw, 1, protowire.BytesType)
+	raw = protowire.AppendString(raw, "1")
+	raw = protowire.AppendTag(raw, 2, protowire.BytesType)
+	raw = protowire.AppendString(raw, "e")
+	raw = protowire.AppendTag(raw, 5, protowire.BytesType)
+	raw = protowire.AppendBytes(raw, errBuf)
+	raw = unknown(raw)
+
+	var got protobuf.Envelope
+	if err := got.Unmarshal(raw); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	checkEnvelope(t, &got, want)
+}
+
+func TestEnvelopeRejectsTruncatedInput(t *testing.T) {
+	env := envelopes(t)[len(envelopes(t))-1].env
+	raw, err := env.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// Cutting between two fields leaves a valid, shorter envelope
+	boundaries := map[int]bool{0: true}
+	for b, offset := raw, 0; len(b) > 0; {
+		_, _, n := protowire.ConsumeField(b)
+		b = b[n:]
+		offset += n
+		boundaries[offset] = true
+	}
+
+	for cut := 1; cut < len(raw); cut++ {
+		var got protobuf.Envelope
+		err := got.Unmarshal(raw[:cut])
+		if boundaries[cut] && err != nil {
+			t.Errorf("cut at field boundary %d: %v", cut, err)
+		}
+
+		if !boundaries[cut] && err == nil {
+			t.Errorf("cut at %d of %d decoded without error", cut, len(raw))
+		}
+	}
+
+	for _, raw := range [][]byte{
+		{0x2a, 0x02, 0x08},       // error holding a truncated tag
+		{0x2a, 0x02, 0x20, 0x80}, // error holding a truncated retryable varint
+		{0x1a, 0x02, 0x0a, 0x05}, // meta holding a truncated entry
+		{0x22, 0x01, 0xff},       // data holding an invalid tag
+	} {
+		var got protobuf.Envelope
+		if err := got.Unmarshal(raw); err == nil {
+			t.Errorf("Unmarshal(%x) succeeded", raw)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package protobuf decodes and encodes messages as Protocol Buffers for
+// clients that negotiate the "protobuf" subprotocol. Each binary frame holds
+// the Envelope message of Envelope.proto, whose data is a
+// google.protobuf.Any. A Registry maps events to message types so that
+// ctx.Unmarshal can produce the concrete message of an event.
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+const Subprotocol = "protobuf"
+
+var ErrUnknownMessageType = errors.New("unknown message type")
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// Middleware handles messages of connections using the protobuf subprotocol
+// and passes every other message on untouched. registry may be nil, in which
+// case the type of a message is taken from its Any type URL.
+func Middleware(registry *Registry) func(ctx *websocket.Context) {
+	codec := Codec(registry)
+	return func(ctx *websocket.Context) {
+		secWebSocketProtocol := ctx.Subprotocol()
+		if secWebSocketProtocol == "" {
+			secWebSocketProtocol = ctx.Headers().Get("Sec-WebSocket-Protocol")
+		}
+
+		if secWebSocketProtocol != Subprotocol {
+			ctx.Next()
+			return
+		}
+
+		messageData, err := decode(ctx.RawData())
+		if err != nil {
+			ctx.Error = err
+			return
+		}
+
+		if messageData.ID != "" {
+			ctx.SetMessageID(messageData.ID)
+		}
+
+		if messageData.Event != "" {
+			ctx.SetMessageEvent(messageData.Event)
+		}
+
+		if messageData.Meta != nil {
+			ctx.SetMessageMeta(messageData.Meta)
+		}
+
+		if messageData.Data != nil {
+			ctx.SetMessageData(messageData.Data)
+		}
+
+		ctx.Socket().SetCodec(codec)
+		ctx.SetMessageType(websocket.MessageBinary)
+		ctx.SetMessageUnmarshaler(func(message *websocket.InboundMessage, into any) error {
+			return unmarshalData(registry, message, into)
+		})
+
+		ctx.SetMessageMarshaller(Marshal)
+		ctx.Next()
+	}
+}
+
+func decode(raw []byte) (*websocket.Envelope, error) {
+	var messageData Envelope
+	if err := messageData.Unmarshal(raw); err != nil {
+		return nil, err
+	}
+
+	envelope := &websocket.Envelope{
+		ID:    messageData.ID,
+		Event: messageData.Event,
+	}
+
+	if messageData.Meta != nil {
+		envelope.Meta = messageData.Meta.AsMap()
+	}
+
+	if messageData.Data != nil {
+		data, err := proto.Marshal(messageData.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		envelope.Data = data
+	}
+
+	return envelope, nil
+}
+
+// unmarshalData decodes the Any held by message into. into can point to a
+// concrete message, to a nil message pointer, which is allocated, or to a
+// proto.Message or any, which receives a message of the type registered for
+// the event or named by the Any.
+func unmarshalData(registry *Registry, message *websocket.InboundMessage, into any) error {
+	if len(message.Data) == 0 {
+		return errors.New("message has no data")
+	}
+
+	data := &anypb.Any{}
+	if err := proto.Unmarshal(message.Data, data); err != nil {
+		return err
+	}
+
+	expected, registered := registry.Lookup(message.Event)
+	if registered && data.MessageName() != expected.Descriptor().FullName() {
+		return fmt.Errorf("event %s expects %s, got %s", message.Event, expected.Descriptor().FullName(), data.MessageName())
+	}
+
+	if msg, ok := into.(proto.Message); ok {
+		return data.UnmarshalTo(msg)
+	}
+
+	target := reflect.ValueOf(into)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("cannot unmarshal into %T", into)
+	}
+
+	elem := target.Elem()
+	if elem.Kind() == reflect.Pointer && elem.Type().Implements(protoMessageType) {
+		msg := reflect.New(elem.Type().Elem())
+		if err := data.UnmarshalTo(msg.Interface().(proto.Message)); err != nil {
+			return err
+		}
+
+		elem.Set(msg)
+		return nil
+	}
+
+	if elem.Kind() != reflect.Interface || !protoMessageType.AssignableTo(elem.Type()) {
+		return fmt.Errorf("cannot unmarshal into %T", into)
+	}
+
+	var messageType protoreflect.MessageType
+	if registered {
+		messageType = expected
+	} else {
+		found, err := protoregistry.GlobalTypes.FindMessageByName(data.MessageName())
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrUnknownMessageType, data.MessageName())
+		}
+
+		messageType = found
+	}
+
+	msg := messageType.New().Interface()
+	if err := data.UnmarshalTo(msg); err != nil {
+		return err
+	}
+
+	elem.Set(reflect.ValueOf(msg))
+	return nil
+}
+
+// Marshal encodes an outbound message as an Envelope. Data that is not a
+// proto.Message is sent as a google.protobuf.Value holding its JSON form.
+func Marshal(message *websocket.OutboundMessage) ([]byte, error) {
+	if err, ok := message.Data.(*websocket.Error); ok && message.Error == nil {
+		message.Data = nil
+		message.Error = err
+	}
+
+	env := &Envelope{
+		ID:    message.ID,
+		Event: message.Event,
+		Error: message.Error,
+	}
+
+	if message.Data != nil {
+		msg, ok := message.Data.(proto.Message)
+		if !ok {
+			value, err := toValue(message.Data)
+			if err != nil {
+				return nil, err
+			}
+
+			msg = value
+		}
+
+		data, err := anypb.New(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		env.Data = data
+	}
+
+	return env.Marshal()
+}
@@ -0,0 +1,173 @@
+package protobuf_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	websocket "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/protobuf"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := protobuf.NewRegistry()
+	registry.MustRegister("chat.:room", &wrapperspb.StringValue{})
+	registry.MustRegister("chat.**", &structpb.Struct{})
+	if err := registry.Register("bad.:", &structpb.Struct{}); err == nil {
+		t.Fatal("Register accepted an invalid pattern")
+	}
+
+	for _, test := range []struct {
+		event string
+		want  proto.Message
+	}{
+		{"chat.lobby", &wrapperspb.StringValue{}},
+		{"chat.lobby.typing", &structpb.Struct{}},
+		{"room.join", nil},
+	} {
+		messageType, ok := registry.Lookup(test.event)
+		if ok != (test.want != nil) {
+			t.Errorf("Lookup(%s) found = %v", test.event, ok)
+			continue
+		}
+
+		if ok && messageType.Descriptor().FullName() != test.want.ProtoReflect().Descriptor().FullName() {
+			t.Errorf("Lookup(%s) = %s, want %s", test.event, messageType.Descriptor().FullName(), test.want.ProtoReflect().Descriptor().FullName())
+		}
+	}
+
+	var missing *protobuf.Registry
+	if _, ok := missing.Lookup("chat.lobby"); ok {
+		t.Error("nil registry found a type")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustRegister did not panic on an invalid pattern")
+		}
+	}()
+
+	registry.MustRegister("bad.:", &structpb.Struct{})
+}
+
+func inbound(t *testing.T, event string, msg proto.Message) *websocket.InboundMessage {
+	t.Helper()
+	data, err := proto.Marshal(mustAny(t, msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &websocket.InboundMessage{Event: event, Data: data}
+}
+
+func TestUnmarshalData(t *testing.T) {
+	registry := protobuf.NewRegistry()
+	registry.MustRegister("name", &wrapperspb.StringValue{})
+	codec := protobuf.Codec(registry)
+	name := inbound(t, "name", wrapperspb.String("ada"))
+	unregistered := inbound(t, "other", wrapperspb.String("ada"))
+
+	t.Run("concrete message", func(t *testing.T) {
+		var got wrapperspb.StringValue
+		if err := codec.Unmarshal(name, &got); err != nil || got.GetValue() != "ada" {
+			t.Fatalf("got %v, %v", &got, err)
+		}
+	})
+
+	t.Run("nil message pointer", func(t *testing.T) {
+		var got *wrapperspb.StringValue
+		if err := codec.Unmarshal(name, &got); err != nil || got.GetValue() != "ada" {
+			t.Fatalf("got %v, %v", got, err)
+		}
+	})
+
+	for _, msg := range []*websocket.InboundMessage{name, unregistered} {
+		t.Run("interface for "+msg.Event, func(t *testing.T) {
+			var got proto.Message
+			if err := codec.Unmarshal(msg, &got); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			if value, ok := got.(*wrapperspb.StringValue); !ok || value.GetValue() != "ada" {
+				t.Fatalf("got %T %v", got, got)
+			}
+
+			var anyValue any
+			if err := codec.Unmarshal(msg, &anyValue); err != nil {
+				t.Fatalf("Unmarshal into any: %v", err)
+			}
+
+			if !proto.Equal(anyValue.(proto.Message), got) {
+				t.Fatalf("any got %v, want %v", anyValue, got)
+			}
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		var value wrapperspb.StringValue
+		var number int
+		unknownType, err := proto.Marshal(&anypb.Any{TypeUrl: "type.googleapis.com/example.Missing"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			name string
+			msg  *websocket.InboundMessage
+			into any
+			want string
+		}{
+			{"no data", &websocket.InboundMessage{Event: "name"}, &value, "no data"},
+			{"invalid data", &websocket.InboundMessage{Event: "name", Data: []byte{0xff}}, &value, ""},
+			{"registered type mismatch", inbound(t, "name", wrapperspb.Int32(1)), &value, "expects google.protobuf.StringValue"},
+			{"wrong concrete type", unregistered, &wrapperspb.Int32Value{}, ""},
+			{"not a message", name, &number, "cannot unmarshal"},
+			{"not a pointer", name, "text", "cannot unmarshal"},
+			{"nil pointer", name, (*proto.Message)(nil), "cannot unmarshal"},
+		} {
+			if err := codec.Unmarshal(test.msg, test.into); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("%s: Unmarshal returned %v, want an error containing %q", test.name, err, test.want)
+			}
+		}
+
+		var got proto.Message
+		err = codec.Unmarshal(&websocket.InboundMessage{Event: "other", Data: unknownType}, &got)
+		if !errors.Is(err, protobuf.ErrUnknownMessageType) {
+			t.Errorf("unknown type returned %v, want ErrUnknownMessageType", err)
+		}
+	})
+}
+
+func TestMarshal(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		msg  *websocket.OutboundMessage
+		want *protobuf.Envelope
+	}{
+		{"proto data", &websocket.OutboundMessage{ID: "1", Data: wrapperspb.String("ada")},
+			&protobuf.Envelope{ID: "1", Data: mustAny(t, wrapperspb.String("ada"))}},
+		{"plain data", &websocket.OutboundMessage{Event: "sum", Data: map[string]int{"sum": 3}},
+			&protobuf.Envelope{Event: "sum", Data: mustAny(t, structpb.NewStructValue(mustStruct(t, map[string]any{"sum": 3.0})))}},
+		{"error data", &websocket.OutboundMessage{ID: "2", Data: websocket.NewError(websocket.CodeForbidden, "no")},
+			&protobuf.Envelope{ID: "2", Error: websocket.NewError(websocket.CodeForbidden, "no")}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			raw, err := protobuf.Marshal(test.msg)
+			if err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+
+			var got protobuf.Envelope
+			if err := got.Unmarshal(raw); err != nil {
+				t.Fatalf("Unmarshal: %v", err)
+			}
+
+			checkEnvelope(t, &got, test.want)
+		})
+	}
+}
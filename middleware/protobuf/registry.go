@@ -0,0 +1,65 @@
+package protobuf
+
+import (
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+// Registry maps events to the message type their data holds. Events are
+// patterns like the ones given to Server.On.
+type Registry struct {
+	mu      sync.RWMutex
+	entries []registryEntry
+}
+
+type registryEntry struct {
+	pattern     *websocket.Pattern
+	messageType protoreflect.MessageType
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register declares that the data of events matching pattern is a message
+// of the same type as msg
+func (r *Registry) Register(pattern string, msg proto.Message) error {
+	p, err := websocket.NewPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, registryEntry{pattern: p, messageType: msg.ProtoReflect().Type()})
+	return nil
+}
+
+// MustRegister is like Register but panics on an invalid pattern
+func (r *Registry) MustRegister(pattern string, msg proto.Message) {
+	if err := r.Register(pattern, msg); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the message type registered for event. Patterns registered
+// first win.
+func (r *Registry) Lookup(event string) (protoreflect.MessageType, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, entry := range r.entries {
+		if entry.pattern.Match(event) {
+			return entry.messageType, true
+		}
+	}
+
+	return nil, false
+}
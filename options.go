@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"github.com/coder/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+type CompressionMode = websocket.CompressionMode
+
+const (
+	CompressionDisabled          CompressionMode = websocket.CompressionDisabled
+	CompressionContextTakeover   CompressionMode = websocket.CompressionContextTakeover
+	CompressionNoContextTakeover CompressionMode = websocket.CompressionNoContextTakeover
+)
+
+// ServerOption configures a Server created with NewServer
+type ServerOption func(s *Server)
+
+func WithOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.SetOrigins(origins)
+	}
+}
+
+func WithLogger(logger *logrus.Logger) ServerOption {
+	return func(s *Server) {
+		s.SetLogger(logger)
+	}
+}
+
+// WithReadLimit sets the maximum size in bytes of a message read from a
+// client. Clients sending larger messages are disconnected with
+// StatusMessageTooBig. The default is 32768 bytes and -1 removes the limit.
+func WithReadLimit(limit int64) ServerOption {
+	return func(s *Server) {
+		s.readLimit = limit
+	}
+}
+
+// WithCompression enables permessage-deflate for clients that support it.
+// Messages smaller than threshold bytes are sent uncompressed; zero keeps the
+// library default for the mode.
+func WithCompression(mode CompressionMode, threshold int) ServerOption {
+	return func(s *Server) {
+		s.compressionMode = mode
+		s.compressionThreshold = threshold
+	}
+}
+
+// WithSubprotocols sets the subprotocols the server supports, in order of
+// preference. The first one also requested by the client is negotiated.
+func WithSubprotocols(subprotocols ...string) ServerOption {
+	return func(s *Server) {
+		s.subprotocols = subprotocols
+	}
+}
+
+// WithInsecureSkipVerify disables the origin check. Only use it when the
+// origin is verified some other way.
+func WithInsecureSkipVerify(skip bool) ServerOption {
+	return func(s *Server) {
+		s.insecureSkipVerify = skip
+	}
+}
+
+func WithProcessingMode(mode ProcessingMode) ServerOption {
+	return func(s *Server) {
+		s.SetProcessingMode(mode)
+	}
+}
+
+func WithOutboundQueue(size int, policy OverflowPolicy) ServerOption {
+	return func(s *Server) {
+		s.SetOutboundQueue(size, policy)
+	}
+}
+
+func (s *Server) acceptOptions() *websocket.AcceptOptions {
+	origins := s.origins
+	if len(origins) == 0 {
+		origins = []string{"*"}
+	}
+
+	return &websocket.AcceptOptions{
+		Subprotocols:         s.subprotocols,
+		InsecureSkipVerify:   s.insecureSkipVerify,
+		OriginPatterns:       origins,
+		CompressionMode:      s.compressionMode,
+		CompressionThreshold: s.compressionThreshold,
+	}
+}
@@ -0,0 +1,140 @@
+package websocket_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	ws "github.com/snapflowio/websocket"
+)
+
+// serve starts an HTTP server for server and returns its websocket URL
+func serve(t *testing.T, server *ws.Server) string {
+	t.Helper()
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+func dial(t *testing.T, endpoint string, opts *websocket.DialOptions) *websocket.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, _, err := websocket.Dial(ctx, endpoint, opts)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.CloseNow()
+	})
+
+	return conn
+}
+
+func TestWithReadLimit(t *testing.T) {
+	server := newJSONServer(t, ws.WithReadLimit(64))
+	handled := make(chan int, 2)
+	on(t, server, "note", func(ctx *ws.Context) {
+		handled <- len(ctx.RawData())
+	})
+
+	conn := dial(t, serve(t, server), nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"event":"note"}`)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	<-handled
+	long := `{"event":"note","data":"` + strings.Repeat("x", 64) + `"}`
+	if err := conn.Write(ctx, websocket.MessageText, []byte(long)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	_, _, err := conn.Read(ctx)
+	if status := websocket.CloseStatus(err); status != websocket.StatusMessageTooBig {
+		t.Fatalf("Read returned %v, want close status %d", err, websocket.StatusMessageTooBig)
+	}
+
+	select {
+	case n := <-handled:
+		t.Fatalf("message of %d bytes over the limit was handled", n)
+	default:
+	}
+}
+
+func TestWithSubprotocols(t *testing.T) {
+	endpoint := serve(t, newJSONServer(t, ws.WithSubprotocols("msgpack", "json")))
+	for _, test := range []struct {
+		requested []string
+		want      string
+	}{
+		{[]string{"json", "msgpack"}, "msgpack"},
+		{[]string{"json"}, "json"},
+		{[]string{"xml"}, ""},
+		{nil, ""},
+	} {
+		conn := dial(t, endpoint, &websocket.DialOptions{Subprotocols: test.requested})
+		if got := conn.Subprotocol(); got != test.want {
+			t.Errorf("client requesting %v got subprotocol %q, want %q", test.requested, got, test.want)
+		}
+	}
+}
+
+func TestWithCompression(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opts    []ws.ServerOption
+		deflate bool
+	}{
+		{"default", nil, false},
+		{"enabled", []ws.ServerOption{ws.WithCompression(ws.CompressionContextTakeover, 0)}, true},
+		{"disabled", []ws.ServerOption{ws.WithCompression(ws.CompressionDisabled, 0)}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			endpoint := serve(t, newJSONServer(t, test.opts...))
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			conn, res, err := websocket.Dial(ctx, endpoint, &websocket.DialOptions{
+				CompressionMode: websocket.CompressionContextTakeover,
+			})
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+
+			defer conn.CloseNow()
+			extensions := res.Header.Get("Sec-WebSocket-Extensions")
+			if deflate := strings.Contains(extensions, "permessage-deflate"); deflate != test.deflate {
+				t.Fatalf("extensions = %q, want deflate %v", extensions, test.deflate)
+			}
+		})
+	}
+}
+
+func TestWithOrigins(t *testing.T) {
+	endpoint := serve(t, newJSONServer(t, ws.WithOrigins("example.com")))
+	for _, test := range []struct {
+		origin string
+		ok     bool
+	}{
+		{"https://example.com", true},
+		{"https://evil.com", false},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		conn, _, err := websocket.Dial(ctx, endpoint, &websocket.DialOptions{
+			HTTPHeader: map[string][]string{"Origin": {test.origin}},
+		})
+		cancel()
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("origin %s: Dial returned %v", test.origin, err)
+		}
+
+		if conn != nil {
+			conn.CloseNow()
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultOutboundQueueSize is a queue size suited to most servers that
+	// opt in to outbound queues with WithOutboundQueue
+	DefaultOutboundQueueSize = 256
+	// outboundFlushTimeout bounds how long a server initiated close waits for
+	// queued messages to be written before sending the close frame.
+	outboundFlushTimeout = 5 * time.Second
+)
+
+// OverflowPolicy decides what Socket.Send does when the outbound queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Send wait until the queue has room
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued message to make room
+	OverflowDropOldest
+	// OverflowDropNewest discards the message being sent
+	OverflowDropNewest
+	// OverflowClose closes the socket with StatusPolicyViolation
+	OverflowClose
+)
+
+type OutboundStats struct {
+	Depth     int
+	Capacity  int
+	HighWater int
+	Sent      uint64
+	Dropped   uint64
+}
+
+type outboundQueue struct {
+	mu        sync.Mutex
+	ready     *sync.Cond
+	space     *sync.Cond
+	items     []*SocketMessage
+	capacity  int
+	policy    OverflowPolicy
+	closed    bool
+	err       error
+	highWater int
+	sent      uint64
+	dropped   uint64
+	done      chan struct{}
+}
+
+func newOutboundQueue(capacity int, policy OverflowPolicy) *outboundQueue {
+	q := &outboundQueue{
+		items:    make([]*SocketMessage, 0, capacity),
+		capacity: capacity,
+		policy:   policy,
+		done:     make(chan struct{}),
+	}
+
+	q.ready = sync.NewCond(&q.mu)
+	q.space = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a message. The returned bool reports whether the socket should
+// be closed because the queue overflowed.
+func (q *outboundQueue) push(msg *SocketMessage) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.closed && q.err == nil && len(q.items) >= q.capacity {
+		switch q.policy {
+		case OverflowDropOldest:
+			q.items[0] = nil
+			q.items = q.items[1:]
+			q.dropped++
+		case OverflowDropNewest:
+			q.dropped++
+			return false, ErrOutboundQueueFull
+		case OverflowClose:
+			// The socket is about to be closed, so there is no point in
+			// flushing the backlog first.
+			q.dropped++
+			q.discard(ErrSocketClosed)
+			return true, ErrOutboundQueueFull
+		default:
+			q.space.Wait()
+		}
+	}
+
+	if q.err != nil {
+		return false, q.err
+	}
+
+	if q.closed {
+		return false, ErrSocketClosed
+	}
+
+	q.items = append(q.items, msg)
+	if len(q.items) > q.highWater {
+		q.highWater = len(q.items)
+	}
+
+	q.ready.Signal()
+	return false, nil
+}
+
+// pop waits for the next message. It returns nil once the queue is closed
+// and drained.
+func (q *outboundQueue) pop() *SocketMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+
+	if len(q.items) == 0 {
+		return nil
+	}
+
+	msg := q.items[0]
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.space.Signal()
+	return msg
+}
+
+// fail records a write error. Queued messages are discarded, after being
+// handed to keep if set, and later sends return the error.
+func (q *outboundQueue) fail(err error, keep func(msgs ...*SocketMessage)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if keep != nil {
+		keep(q.items...)
+	}
+
+	q.discard(err)
+}
+
+// discard drops the queued messages. The caller must hold the lock.
+func (q *outboundQueue) discard(err error) {
+	q.err = err
+	q.dropped += uint64(len(q.items))
+	q.items = q.items[:0]
+	q.space.Broadcast()
+}
+
+func (q *outboundQueue) markSent() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sent++
+}
+
+func (q *outboundQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.ready.Broadcast()
+	q.space.Broadcast()
+}
+
+func (q *outboundQueue) stats() OutboundStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return OutboundStats{
+		Depth:     len(q.items),
+		Capacity:  q.capacity,
+		HighWater: q.highWater,
+		Sent:      q.sent,
+		Dropped:   q.dropped,
+	}
+}
+
+// SetOutboundQueue sets the size of each socket's outbound queue and what
+// happens when it is full. A size of zero or less makes Send write directly
+// from the calling goroutine, which is the default.
+func (s *Server) SetOutboundQueue(size int, policy OverflowPolicy) {
+	s.outboundQueueSize = size
+	s.overflowPolicy = policy
+}
+
+// startWriter gives the socket an outbound queue, drained by its own
+// goroutine once runWriter is called, so a slow client only ever blocks its
+// own writer.
+func (s *Socket) startWriter(size int, policy OverflowPolicy) {
+	if size <= 0 {
+		return
+	}
+
+	s.outbound = newOutboundQueue(size, policy)
+	s.writeCtx, s.cancelWrite = context.WithCancel(context.Background())
+}
+
+// runWriter starts draining the outbound queue. The replayed messages are
+// written first; they already belong to the socket's session history.
+func (s *Socket) runWriter(replay []*SocketMessage) {
+	if s.outbound != nil {
+		go s.writeLoop(replay)
+	}
+}
+
+func (s *Socket) writeLoop(replay []*SocketMessage) {
+	defer close(s.outbound.done)
+	for _, msg := range replay {
+		if err := s.connection.Write(s.writeCtx, msg); err != nil {
+			s.failWriter(err)
+			break
+		}
+	}
+
+	for {
+		msg := s.outbound.pop()
+		if msg == nil {
+			return
+		}
+
+		if s.session != nil {
+			s.session.recordAll(msg)
+		}
+
+		if err := s.connection.Write(s.writeCtx, msg); err != nil {
+			s.failWriter(err)
+			continue
+		}
+
+		s.outbound.markSent()
+	}
+}
+
+// failWriter stops writing after an error. With a session, the discarded
+// messages are kept for the client to receive when it resumes.
+func (s *Socket) failWriter(err error) {
+	if s.session == nil {
+		s.outbound.fail(err, nil)
+		return
+	}
+
+	s.outbound.fail(err, s.session.recordAll)
+}
+
+// stopWriter closes the outbound queue. With flush set it waits for the
+// queued messages to be written, up to outboundFlushTimeout.
+func (s *Socket) stopWriter(flush bool) {
+	if s.outbound == nil {
+		return
+	}
+
+	s.outbound.close()
+	if flush {
+		select {
+		case <-s.outbound.done:
+		case <-time.After(outboundFlushTimeout):
+		}
+	}
+
+	s.cancelWrite()
+}
+
+// OutboundStats reports the state of the socket's outbound queue. Sockets
+// without a queue report zero values.
+func (s *Socket) OutboundStats() OutboundStats {
+	if s.outbound == nil {
+		return OutboundStats{}
+	}
+
+	return s.outbound.stats()
+}
@@ -0,0 +1,212 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+// stalledConn holds back the server's writes until it is released, like a
+// client that stopped reading
+type stalledConn struct {
+	*wstest.Conn
+	writing chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (c *stalledConn) Write(ctx context.Context, msg *ws.SocketMessage) error {
+	select {
+	case c.writing <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return c.Conn.Write(ctx, msg)
+}
+
+func (c *stalledConn) unblock() {
+	c.once.Do(func() {
+		close(c.release)
+	})
+}
+
+// stalledSocket connects a socket with an outbound queue of two messages to
+// a stalled connection and sends "1", which the writer takes and holds.
+func stalledSocket(t *testing.T, policy ws.OverflowPolicy) (*ws.Socket, *stalledConn, *wstest.Conn) {
+	t.Helper()
+	serverConn, clientConn := wstest.Pipe()
+	conn := &stalledConn{
+		Conn:    serverConn,
+		writing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+
+	socket := handle(t, ws.NewServer(ws.WithOutboundQueue(2, policy)), conn)
+	t.Cleanup(conn.unblock)
+	if err := socket.Send(ws.MessageText, []byte("1")); err != nil {
+		t.Fatalf("Send(1): %v", err)
+	}
+
+	<-conn.writing
+	return socket, conn, clientConn
+}
+
+func send(socket *ws.Socket, messages ...string) error {
+	for _, msg := range messages {
+		if err := socket.Send(ws.MessageText, []byte(msg)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receive reads messages from conn until it is closed or nothing arrives
+// for a while
+func receive(conn *wstest.Conn) []string {
+	var got []string
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		msg, err := conn.Read(ctx)
+		cancel()
+		if err != nil {
+			return got
+		}
+
+		got = append(got, string(msg.RawData))
+	}
+}
+
+func expectStats(t *testing.T, socket *ws.Socket, want ws.OutboundStats) {
+	t.Helper()
+	// The writer counts a message as sent after the client has it
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := socket.OutboundStats()
+		if stats == want {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want %+v", stats, want)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOutboundQueueIsOptIn(t *testing.T) {
+	client := wstest.NewClient(t, newJSONServer(t))
+	if stats := client.Socket().OutboundStats(); stats.Capacity != 0 {
+		t.Fatalf("default server queues outbound messages: %+v", stats)
+	}
+
+	server := newJSONServer(t, ws.WithOutboundQueue(8, ws.OverflowDropNewest))
+	on(t, server, "echo", func(ctx *ws.Context) {
+		ctx.Reply(ctx.Data())
+	})
+
+	client = wstest.NewClient(t, server)
+	client.Request("echo", nil)
+	if stats := client.Socket().OutboundStats(); stats.Capacity != 8 {
+		t.Fatalf("stats = %+v, want capacity 8", stats)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	socket, conn, client := stalledSocket(t, ws.OverflowBlock)
+	if err := send(socket, "2", "3"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- send(socket, "4")
+	}()
+
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v while the queue was full", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	conn.unblock()
+	if err := <-sent; err != nil {
+		t.Fatalf("Send(4): %v", err)
+	}
+
+	if got, want := receive(client), []string{"1", "2", "3", "4"}; !slices.Equal(got, want) {
+		t.Fatalf("client got %v, want %v", got, want)
+	}
+
+	expectStats(t, socket, ws.OutboundStats{Capacity: 2, HighWater: 2, Sent: 4})
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	socket, conn, client := stalledSocket(t, ws.OverflowDropOldest)
+	if err := send(socket, "2", "3", "4", "5"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	expectStats(t, socket, ws.OutboundStats{Depth: 2, Capacity: 2, HighWater: 2, Dropped: 2})
+	conn.unblock()
+	if got, want := receive(client), []string{"1", "4", "5"}; !slices.Equal(got, want) {
+		t.Fatalf("client got %v, want %v", got, want)
+	}
+
+	expectStats(t, socket, ws.OutboundStats{Capacity: 2, HighWater: 2, Sent: 3, Dropped: 2})
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	socket, conn, client := stalledSocket(t, ws.OverflowDropNewest)
+	if err := send(socket, "2", "3"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if err := send(socket, "4"); !errors.Is(err, ws.ErrOutboundQueueFull) {
+		t.Fatalf("Send(4) = %v, want ErrOutboundQueueFull", err)
+	}
+
+	conn.unblock()
+	if got, want := receive(client), []string{"1", "2", "3"}; !slices.Equal(got, want) {
+		t.Fatalf("client got %v, want %v", got, want)
+	}
+
+	expectStats(t, socket, ws.OutboundStats{Capacity: 2, HighWater: 2, Sent: 3, Dropped: 1})
+}
+
+func TestOverflowClose(t *testing.T) {
+	socket, conn, client := stalledSocket(t, ws.OverflowClose)
+	if err := send(socket, "2", "3"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if err := send(socket, "4"); !errors.Is(err, ws.ErrOutboundQueueFull) {
+		t.Fatalf("Send(4) = %v, want ErrOutboundQueueFull", err)
+	}
+
+	// The backlog is discarded; only the message being written gets through
+	conn.unblock()
+	if got, want := receive(client), []string{"1"}; !slices.Equal(got, want) {
+		t.Fatalf("client got %v, want %v", got, want)
+	}
+
+	<-socket.Done()
+	if status := client.CloseStatus(); status != ws.StatusPolicyViolation {
+		t.Fatalf("close status = %d, want %d", status, ws.StatusPolicyViolation)
+	}
+
+	expectStats(t, socket, ws.OutboundStats{Capacity: 2, HighWater: 2, Sent: 1, Dropped: 3})
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/grafana/regexp"
@@ -9,7 +10,12 @@ import (
 type Pattern struct {
 	str    string
 	chunks []chunk
+	keys   []string
 	regExp *regexp.Regexp
+	// prefixed patterns start with an optional chunk and are matched against
+	// a non-empty event with a leading separator so the chunk can own its
+	// separator. The empty event is matched as is, leaving the chunk out.
+	prefixed bool
 }
 
 func NewPattern(patternStr string) (*Pattern, error) {
@@ -23,15 +29,65 @@ func NewPattern(patternStr string) (*Pattern, error) {
 		return nil, err
 	}
 
+	keys := make([]string, 0, len(chunks))
+	for _, ch := range chunks {
+		if ch.kind == dynamic {
+			keys = append(keys, ch.key)
+		}
+	}
+
 	return &Pattern{
-		str:    patternStr,
-		chunks: chunks,
-		regExp: patternRegExp,
+		str:      patternStr,
+		chunks:   chunks,
+		keys:     keys,
+		regExp:   patternRegExp,
+		prefixed: len(chunks) > 0 && chunks[0].modifier == optional,
 	}, nil
 }
 
 func (p *Pattern) Match(event string) bool {
-	return p.regExp.MatchString(event)
+	return p.regExp.MatchString(p.subject(event))
+}
+
+// MatchParams reports whether the event matches the pattern and returns the
+// values captured by its named parameters. Optional parameters that did not
+// take part in the match are left out of the map.
+func (p *Pattern) MatchParams(event string) (map[string]string, bool) {
+	if len(p.keys) == 0 {
+		return nil, p.Match(event)
+	}
+
+	event = p.subject(event)
+	indexes := p.regExp.FindStringSubmatchIndex(event)
+	if indexes == nil {
+		return nil, false
+	}
+
+	params := make(map[string]string, len(p.keys))
+	for i, name := range p.regExp.SubexpNames() {
+		if name == "" || indexes[2*i] < 0 {
+			continue
+		}
+
+		params[name] = event[indexes[2*i]:indexes[2*i+1]]
+	}
+
+	return params, true
+}
+
+// subject returns the string the pattern's regular expression is matched
+// against
+func (p *Pattern) subject(event string) string {
+	if p.prefixed && event != "" {
+		return "." + event
+	}
+
+	return event
+}
+
+// Keys returns the names of the pattern's parameters in declaration order.
+func (p *Pattern) Keys() []string {
+	return p.keys
 }
 
 func (p *Pattern) String() string {
@@ -60,28 +116,58 @@ type chunk struct {
 	kind     chunkKind
 	modifier chunkModifier
 	key      string
-	pattern  string
+	// literal is the segment a static chunk matches
+	literal string
+	pattern string
 }
 
+const segmentPattern = "[^.]+"
+
+var paramKeyRegExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func parsePatternChunks(patternStr string) ([]chunk, error) {
 	parts := strings.Split(patternStr, ".")
 	chunks := make([]chunk, 0, len(parts))
+	seenKeys := map[string]bool{}
 
 	for _, part := range parts {
 		if part == "" {
 			continue
 		}
 		ch := chunk{kind: static, modifier: single}
-		switch part {
-		case "*":
+		switch {
+		case part == "*":
 			ch.kind = wildcard
 			ch.modifier = single
-			ch.pattern = "[^.]+"
-		case "**":
+			ch.pattern = segmentPattern
+		case part == "**":
 			ch.kind = wildcard
 			ch.modifier = zeroOrMore
 			ch.pattern = ".*"
+		case strings.HasPrefix(part, ":"):
+			ch.kind = dynamic
+			ch.key = part[1:]
+			switch {
+			case strings.HasSuffix(ch.key, "?"):
+				ch.modifier = optional
+				ch.key = strings.TrimSuffix(ch.key, "?")
+			case strings.HasSuffix(ch.key, "+"):
+				ch.modifier = oneOrMore
+				ch.key = strings.TrimSuffix(ch.key, "+")
+			}
+
+			if !paramKeyRegExp.MatchString(ch.key) {
+				return nil, fmt.Errorf("invalid parameter name %q", part)
+			}
+
+			if seenKeys[ch.key] {
+				return nil, fmt.Errorf("duplicate parameter name %q", ch.key)
+			}
+
+			seenKeys[ch.key] = true
+			ch.pattern = segmentPattern
 		default:
+			ch.literal = part
 			ch.pattern = regexp.QuoteMeta(part)
 		}
 
@@ -96,20 +182,37 @@ func regExpFromChunks(chunks []chunk) (*regexp.Regexp, error) {
 		return regexp.Compile("^$")
 	}
 
+	// Every chunk is written with its leading separator. Unless the pattern
+	// starts with an optional chunk, the first separator is dropped again and
+	// the event is matched as is.
 	var regExpStr strings.Builder
 	regExpStr.WriteString("^")
 	for i, currentChunk := range chunks {
-		if i > 0 {
-			regExpStr.WriteString("\\.")
+		separator := "\\."
+		if i == 0 && currentChunk.modifier != optional {
+			separator = ""
 		}
-		switch currentChunk.modifier {
-		case single:
-			regExpStr.WriteString(currentChunk.pattern)
-		case zeroOrMore:
-			regExpStr.WriteString(currentChunk.pattern)
+
+		value := currentChunk.pattern
+		if currentChunk.kind == dynamic {
+			value = "(?P<" + currentChunk.key + ">" + chunkValuePattern(currentChunk) + ")"
+		}
+
+		if currentChunk.modifier == optional {
+			regExpStr.WriteString("(?:" + separator + value + ")?")
+		} else {
+			regExpStr.WriteString(separator + value)
 		}
 	}
 
 	regExpStr.WriteString("$")
 	return regexp.Compile(regExpStr.String())
 }
+
+func chunkValuePattern(ch chunk) string {
+	if ch.modifier == oneOrMore {
+		return ch.pattern + "(?:\\." + ch.pattern + ")*"
+	}
+
+	return ch.pattern
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestPatternMatchParams(t *testing.T) {
+	tests := []struct {
+		pattern string
+		event   string
+		match   bool
+		params  map[string]string
+	}{
+		{"chat", "chat", true, nil},
+		{"chat", "chat.x", false, nil},
+		{"user.*", "user.login", true, nil},
+		{"user.*", "user", false, nil},
+		{"game.**", "game.player.move", true, nil},
+		{"chat.:room.message", "chat.lobby.message", true, map[string]string{"room": "lobby"}},
+		{"chat.:room.message", "chat..message", false, nil},
+		{"user.:id?", "user", true, map[string]string{}},
+		{"user.:id?", "user.42", true, map[string]string{"id": "42"}},
+		{"files.:path+", "files.a.b.c", true, map[string]string{"path": "a.b.c"}},
+		{"files.:path+", "files", false, nil},
+		{":a?", "", true, map[string]string{}},
+		{":a?", "x", true, map[string]string{"a": "x"}},
+		{":a?", "x.y", false, nil},
+		{":a?.:b?", "", true, map[string]string{}},
+		{":a?.:b?", "x.y", true, map[string]string{"a": "x", "b": "y"}},
+		{":a?.b", "b", true, map[string]string{}},
+		{":a?.b", "x.b", true, map[string]string{"a": "x"}},
+		{":a?.b", "", false, nil},
+		{"", "", true, nil},
+		{"price$", "price$", true, nil},
+		{"a.b+c", "a.b+c", true, nil},
+		{"x.(y)", "x.(y)", true, nil},
+		{"x.(y)", "x.y", false, nil},
+	}
+
+	for _, tt := range tests {
+		pattern, err := NewPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("NewPattern(%q): %v", tt.pattern, err)
+		}
+
+		params, ok := pattern.MatchParams(tt.event)
+		if ok != tt.match {
+			t.Errorf("%q.MatchParams(%q) matched = %v, want %v", tt.pattern, tt.event, ok, tt.match)
+			continue
+		}
+
+		if ok != pattern.Match(tt.event) {
+			t.Errorf("%q: Match(%q) disagrees with MatchParams", tt.pattern, tt.event)
+		}
+
+		if ok && tt.params != nil && !maps.Equal(params, tt.params) {
+			t.Errorf("%q.MatchParams(%q) = %v, want %v", tt.pattern, tt.event, params, tt.params)
+		}
+	}
+}
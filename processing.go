@@ -0,0 +1,123 @@
+package websocket
+
+import "sync"
+
+// ProcessingMode controls how many messages of a single socket are handled
+// at the same time.
+type ProcessingMode struct {
+	maxInFlight int
+}
+
+var (
+	// ConcurrentProcessing handles every message in its own goroutine as soon
+	// as it is read. Messages of one socket may be handled out of order.
+	ConcurrentProcessing = ProcessingMode{}
+	// SequentialProcessing handles the messages of a socket one at a time, in
+	// the order they were received. The socket cannot read a reply while a
+	// handler runs, so Context.Request returns ErrSequentialRequest there.
+	SequentialProcessing = ProcessingMode{maxInFlight: 1}
+)
+
+// BoundedProcessing handles up to n messages of a socket at once. The socket
+// stops reading while n handlers are running, which pushes back on clients
+// that send faster than they are served. A handler waiting on Context.Request
+// frees its slot until the reply came. BoundedProcessing(1) is
+// SequentialProcessing.
+func BoundedProcessing(n int) ProcessingMode {
+	if n < 1 {
+		n = 1
+	}
+
+	return ProcessingMode{maxInFlight: n}
+}
+
+// MaxInFlight returns the number of messages a socket may handle at once, or
+// zero if it is unbounded.
+func (m ProcessingMode) MaxInFlight() int {
+	return m.maxInFlight
+}
+
+func (s *Server) SetProcessingMode(mode ProcessingMode) {
+	s.processingMode = mode
+}
+
+func (s *Socket) setProcessingMode(mode ProcessingMode) {
+	if mode.maxInFlight > 0 {
+		s.slots = make(chan struct{}, mode.maxInFlight)
+	} else {
+		s.slots = nil
+	}
+}
+
+// acquireSlot blocks until the socket may handle another message. It returns
+// false if the socket closed while waiting.
+func (s *Socket) acquireSlot() bool {
+	if s.slots == nil {
+		return true
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-s.Done():
+		return false
+	}
+}
+
+// processingSlot is the slot a message of a bounded socket is handled in.
+// The contexts of the message share it, so a slot given up while waiting for
+// a reply is never released twice.
+type processingSlot struct {
+	socket  *Socket
+	mu      sync.Mutex
+	held    bool
+	waiting int
+}
+
+func newProcessingSlot(socket *Socket) *processingSlot {
+	if socket.slots == nil {
+		return nil
+	}
+
+	return &processingSlot{socket: socket, held: true}
+}
+
+// sequential reports whether the socket handles one message at a time
+func (p *processingSlot) sequential() bool {
+	return cap(p.socket.slots) == 1
+}
+
+// yield gives up the slot while the handler waits for a reply from the
+// client, so the socket can read the reply
+func (p *processingSlot) yield() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waiting++
+	if p.held {
+		p.held = false
+		<-p.socket.slots
+	}
+}
+
+// reclaim takes the slot back once no request of the message is waiting. It
+// returns false if the socket closed first.
+func (p *processingSlot) reclaim() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.waiting--
+	if p.waiting > 0 || p.held {
+		return true
+	}
+
+	p.held = p.socket.acquireSlot()
+	return p.held
+}
+
+func (p *processingSlot) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held {
+		p.held = false
+		<-p.socket.slots
+	}
+}
@@ -0,0 +1,118 @@
+package websocket_test
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+func TestSequentialProcessingKeepsOrder(t *testing.T) {
+	server := newJSONServer(t)
+	server.SetProcessingMode(ws.SequentialProcessing)
+	var mu sync.Mutex
+	var handled []int
+	done := make(chan struct{})
+	on(t, server, "step", func(ctx *ws.Context) {
+		var step int
+		ctx.Unmarshal(&step)
+		if step == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, step)
+		if len(handled) == 5 {
+			close(done)
+		}
+	})
+
+	client := wstest.NewClient(t, server)
+	for step := range 5 {
+		client.Emit("step", step)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("messages were not handled")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []int{0, 1, 2, 3, 4}; !slices.Equal(handled, want) {
+		t.Fatalf("handled %v, want %v", handled, want)
+	}
+}
+
+func TestSequentialProcessingRejectsRequests(t *testing.T) {
+	server := newJSONServer(t)
+	server.SetProcessingMode(ws.SequentialProcessing)
+	errs := make(chan error, 1)
+	on(t, server, "ask", func(ctx *ws.Context) {
+		_, err := ctx.RequestWithTimeout("ping", time.Second)
+		errs <- err
+	})
+
+	client := wstest.NewClient(t, server)
+	client.Emit("ask", nil)
+	if err := <-errs; !errors.Is(err, ws.ErrSequentialRequest) {
+		t.Fatalf("Request returned %v, want ErrSequentialRequest", err)
+	}
+
+	client.ExpectNoMessage(20 * time.Millisecond)
+}
+
+func TestBoundedProcessingYieldsSlotDuringRequest(t *testing.T) {
+	server := newJSONServer(t)
+	server.SetProcessingMode(ws.BoundedProcessing(2))
+	replies := make(chan string, 1)
+	on(t, server, "ask", func(ctx *ws.Context) {
+		var reply string
+		if err := ctx.RequestIntoWithTimeout("ping", &reply, time.Second); err != nil {
+			t.Errorf("Request: %v", err)
+		}
+
+		replies <- reply
+	})
+
+	release := make(chan struct{})
+	running := make(chan int, 3)
+	on(t, server, "block", func(ctx *ws.Context) {
+		var n int
+		ctx.Unmarshal(&n)
+		running <- n
+		<-release
+	})
+
+	client := wstest.NewClient(t, server)
+	client.Emit("block", 1)
+	<-running
+
+	// The request frees its slot, so the reply is read while the other slot
+	// is taken
+	client.Emit("ask", nil)
+	client.Reply(client.Receive(), "pong")
+	if reply := <-replies; reply != "pong" {
+		t.Fatalf("reply = %q, want pong", reply)
+	}
+
+	// The request took its slot back and released it once: the socket still
+	// handles two messages at most
+	client.Emit("block", 2)
+	client.Emit("block", 3)
+	<-running
+	select {
+	case n := <-running:
+		t.Fatalf("message %d handled while both slots were taken", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-running
+}
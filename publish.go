@@ -0,0 +1,115 @@
+package websocket
+
+import "context"
+
+// SetCodec sets the codec of messages the server sends outside of handlers,
+// with Emit, To and EmitToSocket. Sockets whose codec is known get messages
+// in their own codec; the server's codec is used for the others and for
+// other nodes.
+func (s *Server) SetCodec(codec Codec) {
+	s.codec = codec
+	s.roomManager.mu.Lock()
+	s.roomManager.codec = codec
+	s.roomManager.mu.Unlock()
+}
+
+func WithCodec(codec Codec) ServerOption {
+	return func(s *Server) {
+		s.SetCodec(codec)
+	}
+}
+
+// Codec returns the server's default codec, or nil if none is set
+func (s *Server) Codec() Codec {
+	return s.codec
+}
+
+// Emit sends event to every connected socket, including the ones on other
+// nodes. It returns the number of local sockets the message was sent to.
+func (s *Server) Emit(event string, data any) int {
+	return s.publish(&AdapterMessage{}, s.Sockets(), event, data)
+}
+
+// To returns an emitter that sends to the members of room
+func (s *Server) To(room string) *ServerEmitter {
+	return s.ToRooms(room)
+}
+
+// ToRooms returns an emitter that sends to the members of any of rooms
+func (s *Server) ToRooms(rooms ...string) *ServerEmitter {
+	return &ServerEmitter{server: s, rooms: rooms}
+}
+
+// EmitToSocket sends event to the socket with the given ID, on this node or
+// another one
+func (s *Server) EmitToSocket(socketID string, event string, data any) error {
+	f := s.fanout(&OutboundMessage{Event: event, Data: data})
+	if socket := s.Socket(socketID); socket != nil {
+		return f.sendTo(socket)
+	}
+
+	return f.publishTo(s.roomManager, socketID)
+}
+
+// ServerEmitter sends messages to rooms from outside of handlers
+type ServerEmitter struct {
+	server *Server
+	rooms  []string
+	except []string
+}
+
+// Except leaves out the sockets with the given IDs
+func (e *ServerEmitter) Except(socketIDs ...string) *ServerEmitter {
+	e.except = append(e.except, socketIDs...)
+	return e
+}
+
+// Emit sends event to the members of the emitter's rooms, including the ones
+// on other nodes. Sockets in several of the rooms get the message once. It
+// returns the number of local sockets the message was sent to.
+func (e *ServerEmitter) Emit(event string, data any) int {
+	seen := make(map[*Socket]bool)
+	var targets []*Socket
+	for _, roomName := range e.rooms {
+		room := e.server.roomManager.GetRoom(roomName)
+		if room == nil {
+			continue
+		}
+
+		for _, socket := range room.Sockets() {
+			if !seen[socket] {
+				seen[socket] = true
+				targets = append(targets, socket)
+			}
+		}
+	}
+
+	return e.server.publish(&AdapterMessage{Rooms: e.rooms, Except: e.except}, targets, event, data)
+}
+
+// Pipe emits every value received from ch to the members of room as event,
+// until ch is closed or ctx ends. It blocks, so it is usually run in its own
+// goroutine.
+//
+//	go websocket.Pipe(ctx, server, "prices", "price", prices)
+func Pipe[T any](ctx context.Context, s *Server, room string, event string, ch <-chan T) error {
+	emitter := s.To(room)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case value, ok := <-ch:
+			if !ok {
+				return nil
+			}
+
+			emitter.Emit(event, value)
+		}
+	}
+}
+
+// publish sends a message to the local targets not listed in msg.Except and
+// hands it to the adapter for the other nodes
+func (s *Server) publish(msg *AdapterMessage, targets []*Socket, event string, data any) int {
+	return s.fanout(&OutboundMessage{Event: event, Data: data}).deliver(s.roomManager, targets, msg)
+}
@@ -2,21 +2,41 @@ package websocket
 
 import (
 	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Room struct {
-	name    string
-	sockets map[*Socket]bool
-	mu      sync.RWMutex
-	manager *RoomManager
+	name        string
+	sockets     map[*Socket]bool
+	mu          sync.RWMutex
+	manager     *RoomManager
+	deleted     bool
+	deleteTimer *time.Timer
+	stateMu     sync.Mutex
+	state       map[string]any
+	stateSeq    uint64
+	presenceMu  sync.Mutex
+	presence    map[string]*presenceEntry
+	presenceSeq uint64
 }
 
 type RoomManager struct {
-	rooms  map[string]*Room
-	mu     sync.RWMutex
-	logger *logrus.Logger
+	rooms              map[string]*Room
+	mu                 sync.RWMutex
+	logger             *logrus.Logger
+	adapter            Adapter
+	localSockets       func() []*Socket
+	localSocket        func(id string) *Socket
+	hooks              roomHooks
+	autoDelete         bool
+	deleteGrace        time.Duration
+	codec              Codec
+	stateChangeEvent   string
+	stateSnapshotEvent string
+	presenceKey        func(socket *Socket) string
+	presenceEvents     PresenceEvents
 }
 
 func NewRoomManager(logger *logrus.Logger) *RoomManager {
@@ -25,15 +45,119 @@ func NewRoomManager(logger *logrus.Logger) *RoomManager {
 	}
 
 	return &RoomManager{
-		rooms:  make(map[string]*Room),
-		logger: logger,
+		rooms:          make(map[string]*Room),
+		logger:         logger,
+		adapter:        NewMemoryAdapter(),
+		presenceEvents: DefaultPresenceEvents,
 	}
 }
 
+// SetAdapter starts the adapter and makes the room manager publish through
+// it, closing the previous one. It must be called before sockets connect.
+func (rm *RoomManager) SetAdapter(adapter Adapter) error {
+	if adapter == nil {
+		adapter = NewMemoryAdapter()
+	}
+
+	if err := adapter.Start(rm.deliver); err != nil {
+		return err
+	}
+
+	rm.mu.Lock()
+	previous := rm.adapter
+	rm.adapter = adapter
+	rm.mu.Unlock()
+	return previous.Close()
+}
+
+func (rm *RoomManager) Adapter() Adapter {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.adapter
+}
+
+// RemoteSockets returns the IDs of the members of room connected to other
+// nodes, or of all remote sockets if room is empty.
+func (rm *RoomManager) RemoteSockets(room string) ([]string, error) {
+	return rm.Adapter().RemoteSockets(room)
+}
+
+func (rm *RoomManager) publish(msg *AdapterMessage) {
+	if err := rm.Adapter().Publish(msg); err != nil && rm.logger != nil {
+		rm.logger.WithError(err).Warn("Failed to publish message through adapter")
+	}
+}
+
+func (rm *RoomManager) notifyAdapter(action string, fn func(adapter Adapter) error) {
+	if err := fn(rm.Adapter()); err != nil && rm.logger != nil {
+		rm.logger.WithError(err).WithField("action", action).Warn("Failed to update adapter")
+	}
+}
+
+// deliver sends a message published by another node to the local sockets it targets
+func (rm *RoomManager) deliver(msg *AdapterMessage) {
+	var targets []*Socket
+	switch {
+	case msg.SocketID != "":
+		if socket := rm.localSocketByID(msg.SocketID); socket != nil {
+			targets = []*Socket{socket}
+		}
+	case len(msg.Rooms) > 0:
+		seen := make(map[*Socket]bool)
+		for _, roomName := range msg.Rooms {
+			room := rm.GetRoom(roomName)
+			if room == nil {
+				continue
+			}
+
+			for _, socket := range room.Sockets() {
+				if !seen[socket] {
+					seen[socket] = true
+					targets = append(targets, socket)
+				}
+			}
+		}
+	default:
+		targets = rm.allLocalSockets()
+	}
+
+	except := make(map[string]bool, len(msg.Except))
+	for _, id := range msg.Except {
+		except[id] = true
+	}
+
+	for _, socket := range targets {
+		if except[socket.ID()] {
+			continue
+		}
+
+		if err := socket.Send(msg.MessageType, msg.Data); err != nil && rm.logger != nil {
+			rm.logger.WithError(err).WithField("socketId", socket.ID()).Warn("Failed to deliver adapter message to socket")
+		}
+	}
+}
+
+func (rm *RoomManager) allLocalSockets() []*Socket {
+	if rm.localSockets != nil {
+		return rm.localSockets()
+	}
+
+	return rm.GetAllSockets()
+}
+
+func (rm *RoomManager) localSocketByID(id string) *Socket {
+	if rm.localSocket != nil {
+		return rm.localSocket(id)
+	}
+
+	return rm.GetSocketByID(id)
+}
+
+// Room returns the room called name, creating it if it does not exist
 func (rm *RoomManager) Room(name string) *Room {
 	rm.mu.Lock()
-	defer rm.mu.Unlock()
 	if room, exists := rm.rooms[name]; exists {
+		rm.mu.Unlock()
 		return room
 	}
 
@@ -44,7 +168,8 @@ func (rm *RoomManager) Room(name string) *Room {
 	}
 
 	rm.rooms[name] = room
-
+	rm.mu.Unlock()
+	rm.roomCreated(room)
 	return room
 }
 
@@ -54,14 +179,22 @@ func (rm *RoomManager) GetRoom(name string) *Room {
 	return rm.rooms[name]
 }
 
+// DeleteRoom removes every member from the room and deletes it
 func (rm *RoomManager) DeleteRoom(name string) {
 	rm.mu.Lock()
-	defer rm.mu.Unlock()
-
-	if room, exists := rm.rooms[name]; exists {
-		room.RemoveAll()
+	room, exists := rm.rooms[name]
+	if exists {
 		delete(rm.rooms, name)
+		room.markDeleted()
 	}
+
+	rm.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	room.RemoveAll()
+	rm.roomDeleted(room)
 }
 func (rm *RoomManager) Rooms() []string {
 	rm.mu.RLock()
@@ -115,48 +248,81 @@ func (r *Room) Name() string {
 	return r.name
 }
 
-func (r *Room) addSocket(socket *Socket) {
+// addSocket adds socket to the room. It reports whether the socket was not a
+// member yet, and fails if the room was deleted.
+func (r *Room) addSocket(socket *Socket) (added bool, ok bool) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	if r.deleted {
+		r.mu.Unlock()
+		return false, false
+	}
+
+	added = !r.sockets[socket]
 	r.sockets[socket] = true
+	r.stopDeleteTimer()
+	r.mu.Unlock()
+	if !added {
+		return false, true
+	}
+
 	if r.manager.logger != nil {
 		r.manager.logger.WithFields(logrus.Fields{
 			"room":     r.name,
 			"socketId": socket.ID(),
 		}).Debug("Socket joined room")
 	}
+
+	r.manager.notifyAdapter("join", func(adapter Adapter) error {
+		return adapter.Join(r.name, socket.ID())
+	})
+
+	return true, true
 }
 
+// removeSocket removes socket from the room and runs the leave hooks. The
+// caller must not hold the socket's rooms lock.
 func (r *Room) removeSocket(socket *Socket) {
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	member := r.sockets[socket]
 	delete(r.sockets, socket)
+	empty := member && len(r.sockets) == 0 && !r.deleted
+	r.mu.Unlock()
+	if !member {
+		return
+	}
+
 	if r.manager.logger != nil {
 		r.manager.logger.WithFields(logrus.Fields{
 			"room":     r.name,
 			"socketId": socket.ID(),
 		}).Debug("Socket left room")
 	}
+
+	r.manager.notifyAdapter("leave", func(adapter Adapter) error {
+		return adapter.Leave(r.name, socket.ID())
+	})
+
+	r.manager.left(r, socket, empty)
 }
 
 func (r *Room) Join(socket *Socket) {
-	socket.roomsMx.Lock()
-	defer socket.roomsMx.Unlock()
-	socket.rooms[r.name] = r
-	r.addSocket(socket)
+	r.manager.join(r.name, socket)
 }
 
 func (r *Room) Leave(socket *Socket) {
 	socket.roomsMx.Lock()
-	defer socket.roomsMx.Unlock()
-	delete(socket.rooms, r.name)
+	if socket.rooms[r.name] == r {
+		delete(socket.rooms, r.name)
+	}
+
+	socket.roomsMx.Unlock()
 	r.removeSocket(socket)
 }
 
 func (r *Room) RemoveAll() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.sockets = make(map[*Socket]bool)
+	for _, socket := range r.Sockets() {
+		r.Leave(socket)
+	}
 }
 
 func (r *Room) Size() int {
@@ -182,46 +348,18 @@ func (r *Room) Sockets() []*Socket {
 	return sockets
 }
 
+// Emit sends event to the members of the room that are not excluded, and to
+// its members on other nodes. Every member gets the message in the codec of
+// its socket; marshaller and messageType encode it for sockets without a
+// codec and for the other nodes.
 func (r *Room) Emit(event string, data any, marshaller func(*OutboundMessage) ([]byte, error), messageType MessageType, exclude ...*Socket) int {
-	if marshaller == nil {
-		if r.manager.logger != nil {
-			r.manager.logger.Error("No marshaller provided for room emit")
-		}
-		return 0
-	}
-
-	msgBuf, err := marshaller(&OutboundMessage{Data: data})
-	if err != nil {
-		if r.manager.logger != nil {
-			r.manager.logger.WithError(err).Error("Failed to marshal message for room emit")
-		}
-		return 0
-	}
-
-	sockets := r.Sockets()
-	excludeMap := make(map[*Socket]bool, len(exclude))
-	for _, s := range exclude {
-		excludeMap[s] = true
-	}
-
-	sent := 0
-	for _, socket := range sockets {
-		if excludeMap[socket] {
-			continue
-		}
-
-		if err := socket.Send(messageType, msgBuf); err != nil {
-			if r.manager.logger != nil {
-				r.manager.logger.WithError(err).WithField("socketId", socket.ID()).Warn("Failed to send to socket in room")
-			}
-
-			continue
-		}
-		sent++
-	}
-
-	return sent
+	f := newFanout(&OutboundMessage{Event: event, Data: data}, marshaller, messageType)
+	return f.deliver(r.manager, r.Sockets(), &AdapterMessage{
+		Rooms:  []string{r.name},
+		Except: socketIDs(exclude),
+	})
 }
+
 func (r *Room) Broadcast(data []byte, messageType MessageType, exclude ...*Socket) int {
 	sockets := r.Sockets()
 	excludeMap := make(map[*Socket]bool, len(exclude))
@@ -244,6 +382,13 @@ func (r *Room) Broadcast(data []byte, messageType MessageType, exclude ...*Socke
 		sent++
 	}
 
+	r.manager.publish(&AdapterMessage{
+		Rooms:       []string{r.name},
+		Except:      socketIDs(exclude),
+		MessageType: messageType,
+		Data:        data,
+	})
+
 	return sent
 }
 
@@ -284,11 +429,13 @@ func (c *Context) To(roomName string) *RoomEmitter {
 		}
 	}
 
+	emitter.roomName = roomName
 	return emitter
 }
 
 type RoomEmitter struct {
 	room        *Room
+	roomName    string
 	rooms       []string
 	ctx         *Context
 	exclude     []*Socket
@@ -301,104 +448,125 @@ func (re *RoomEmitter) Except(sockets ...*Socket) *RoomEmitter {
 }
 
 func (re *RoomEmitter) Emit(data any) int {
+	return re.EmitEvent("", data)
+}
+
+// EmitEvent is like Emit and sets the event of the message
+func (re *RoomEmitter) EmitEvent(event string, data any) int {
 	if re.ctx == nil {
 		return 0
 	}
 
 	if len(re.rooms) > 0 {
-		return re.emitToMultipleRooms(data)
+		return re.emitToMultipleRooms(re.rooms, event, data)
 	}
 
 	if re.room == nil {
-		return 0
+		// The room has no local members but may have some on other nodes
+		return re.emitToMultipleRooms([]string{re.roomName}, event, data)
 	}
 
-	return re.room.Emit("", data, re.ctx.messageMarshaller, re.messageType, re.exclude...)
+	return re.room.Emit(event, data, re.ctx.messageMarshaller, re.messageType, re.exclude...)
 }
 
-func (re *RoomEmitter) emitToMultipleRooms(data any) int {
+func (re *RoomEmitter) emitToMultipleRooms(rooms []string, event string, data any) int {
 	if re.ctx.socket == nil || re.ctx.socket.roomManager == nil {
 		return 0
 	}
 
 	socketMap := make(map[*Socket]bool)
-
-	for _, roomName := range re.rooms {
+	var sockets []*Socket
+	for _, roomName := range rooms {
 		room := re.ctx.socket.roomManager.GetRoom(roomName)
-		if room != nil {
-			room.mu.RLock()
-			for socket := range room.sockets {
-				socketMap[socket] = true
-			}
-			room.mu.RUnlock()
-		}
-	}
-
-	excludeMap := make(map[*Socket]bool)
-	for _, socket := range re.exclude {
-		excludeMap[socket] = true
-	}
-
-	msgBytes := re.ctx.mustMarshal(data)
-	sent := 0
-	for socket := range socketMap {
-		if excludeMap[socket] {
+		if room == nil {
 			continue
 		}
 
-		if err := socket.Send(re.messageType, msgBytes); err == nil {
-			sent++
+		for _, socket := range room.Sockets() {
+			if !socketMap[socket] {
+				socketMap[socket] = true
+				sockets = append(sockets, socket)
+			}
 		}
 	}
 
-	return sent
+	f := newFanout(&OutboundMessage{Event: event, Data: data}, re.ctx.messageMarshaller, re.messageType)
+	return f.deliver(re.ctx.socket.roomManager, sockets, &AdapterMessage{
+		Rooms:  rooms,
+		Except: socketIDs(re.exclude),
+	})
 }
+
 func (c *Context) Broadcast(data any) int {
-	if c.socket == nil || c.socket.roomManager == nil {
+	if c.socket == nil {
 		return 0
 	}
 
-	allSockets := c.socket.roomManager.GetAllSockets()
-	sent := 0
-	for _, socket := range allSockets {
-		if err := socket.Send(c.messageType, c.mustMarshal(data)); err == nil {
-			sent++
-		}
-	}
-
-	return sent
+	return c.fanout(data).deliver(c.socket.roomManager, c.allSockets(), &AdapterMessage{})
 }
 func (c *Context) BroadcastExceptMe(data any) int {
-	if c.socket == nil || c.socket.roomManager == nil {
+	if c.socket == nil {
 		return 0
 	}
 
-	allSockets := c.socket.roomManager.GetAllSockets()
-	sent := 0
-	msgBytes := c.mustMarshal(data)
-	for _, socket := range allSockets {
-		if socket == c.socket {
-			continue
-		}
-
-		if err := socket.Send(c.messageType, msgBytes); err == nil {
-			sent++
-		}
-	}
-
-	return sent
+	return c.fanout(data).deliver(c.socket.roomManager, c.allSockets(), &AdapterMessage{
+		Except: []string{c.socket.ID()},
+	})
 }
+
+// EmitTo sends data to the socket with the given ID, on this node or another
+// one. Like before sockets were tracked by the server, an unknown socket or a
+// freed context is not an error: the message is dropped and nil returned.
+// Use Server.EmitToSocket to find out whether the socket exists.
 func (c *Context) EmitTo(socketID string, data any) error {
-	if c.socket == nil || c.socket.roomManager == nil {
+	if c.socket == nil {
 		return nil
 	}
-	targetSocket := c.socket.roomManager.GetSocketByID(socketID)
-	if targetSocket == nil {
+
+	var targetSocket *Socket
+	if c.socket.server != nil {
+		targetSocket = c.socket.server.Socket(socketID)
+	} else if c.socket.roomManager != nil {
+		targetSocket = c.socket.roomManager.GetSocketByID(socketID)
+	}
+
+	f := c.fanout(data)
+	if targetSocket != nil {
+		return f.sendTo(targetSocket)
+	}
+
+	if c.socket.roomManager == nil {
 		return nil
 	}
 
-	msgBytes := c.mustMarshal(data)
-	return targetSocket.Send(c.messageType, msgBytes)
+	if err := f.publishTo(c.socket.roomManager, socketID); err != ErrSocketNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func socketIDs(sockets []*Socket) []string {
+	ids := make([]string, 0, len(sockets))
+	for _, socket := range sockets {
+		ids = append(ids, socket.ID())
+	}
+
+	return ids
+}
+
+// allSockets returns every socket connected to the sender's server. Sockets
+// that are not served by a Server fall back to the members of all rooms.
+func (c *Context) allSockets() []*Socket {
+	if c.socket.server != nil {
+		return c.socket.server.Sockets()
+	}
+
+	if c.socket.roomManager != nil {
+		return c.socket.roomManager.GetAllSockets()
+	}
+
+	return nil
 }
 
 func (c *Context) ToRooms(roomNames ...string) *RoomEmitter {
@@ -417,14 +585,9 @@ func (c *Context) ToRooms(roomNames ...string) *RoomEmitter {
 	return emitter
 }
 
-func (c *Context) mustMarshal(data any) []byte {
-	msg := &OutboundMessage{Data: data}
-	bytes, err := c.messageMarshaller(msg)
-	if err != nil {
-		return []byte{}
-	}
-
-	return bytes
+// fanout creates a fanout that falls back to the context's marshaller
+func (c *Context) fanout(data any) *fanout {
+	return newFanout(&OutboundMessage{Data: data}, c.messageMarshaller, c.messageType)
 }
 
 func (s *Server) Rooms() *RoomManager {
@@ -0,0 +1,193 @@
+package websocket
+
+import "time"
+
+// RoomHook is called when a room is created, becomes empty or is deleted
+type RoomHook func(room *Room)
+
+// MemberHook is called when a socket joins or leaves a room
+type MemberHook func(room *Room, socket *Socket)
+
+type roomHooks struct {
+	create []RoomHook
+	join   []MemberHook
+	leave  []MemberHook
+	empty  []RoomHook
+	delete []RoomHook
+}
+
+// OnRoomCreate adds a hook called after a room is created
+func (rm *RoomManager) OnRoomCreate(hook RoomHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.hooks.create = append(rm.hooks.create, hook)
+}
+
+// OnJoin adds a hook called after a socket joined a room. Joining a room the
+// socket is already in does not call it.
+func (rm *RoomManager) OnJoin(hook MemberHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.hooks.join = append(rm.hooks.join, hook)
+}
+
+// OnLeave adds a hook called after a socket left a room, including when it
+// disconnects or the room is deleted
+func (rm *RoomManager) OnLeave(hook MemberHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.hooks.leave = append(rm.hooks.leave, hook)
+}
+
+// OnRoomEmpty adds a hook called after the last socket left a room
+func (rm *RoomManager) OnRoomEmpty(hook RoomHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.hooks.empty = append(rm.hooks.empty, hook)
+}
+
+// OnRoomDelete adds a hook called after a room was deleted, by DeleteRoom or
+// because it was empty
+func (rm *RoomManager) OnRoomDelete(hook RoomHook) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.hooks.delete = append(rm.hooks.delete, hook)
+}
+
+// SetAutoDelete makes the room manager delete rooms that stayed empty for
+// grace. A zero grace deletes them as soon as the last socket leaves. Rooms
+// are kept until DeleteRoom is called when disabled, which is the default.
+func (rm *RoomManager) SetAutoDelete(enabled bool, grace time.Duration) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.autoDelete = enabled
+	rm.deleteGrace = grace
+}
+
+// WithRoomAutoDelete deletes rooms that stayed empty for grace
+func WithRoomAutoDelete(grace time.Duration) ServerOption {
+	return func(s *Server) {
+		s.roomManager.SetAutoDelete(true, grace)
+	}
+}
+
+func (rm *RoomManager) currentHooks() roomHooks {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.hooks
+}
+
+// join adds socket to the room called name, creating it if needed. A room
+// deleted in the meantime is replaced by a new one.
+func (rm *RoomManager) join(name string, socket *Socket) {
+	for {
+		room := rm.Room(name)
+		socket.roomsMx.Lock()
+		added, ok := room.addSocket(socket)
+		if ok {
+			socket.rooms[name] = room
+		}
+
+		socket.roomsMx.Unlock()
+		if !ok {
+			continue
+		}
+
+		if added {
+			room.sendSnapshot(socket)
+			for _, hook := range rm.currentHooks().join {
+				hook(room, socket)
+			}
+		}
+
+		return
+	}
+}
+
+// left ends the presence of a socket that left room, runs the hooks and
+// deletes the room if it is now empty and auto deletion is enabled
+func (rm *RoomManager) left(room *Room, socket *Socket, empty bool) {
+	room.removePresence(socket)
+	hooks := rm.currentHooks()
+	for _, hook := range hooks.leave {
+		hook(room, socket)
+	}
+
+	if !empty {
+		return
+	}
+
+	for _, hook := range hooks.empty {
+		hook(room)
+	}
+
+	rm.mu.RLock()
+	enabled, grace := rm.autoDelete, rm.deleteGrace
+	rm.mu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	if grace <= 0 {
+		rm.deleteIfEmpty(room)
+		return
+	}
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if room.deleted || len(room.sockets) > 0 {
+		return
+	}
+
+	room.stopDeleteTimer()
+	room.deleteTimer = time.AfterFunc(grace, func() {
+		rm.deleteIfEmpty(room)
+	})
+}
+
+func (rm *RoomManager) roomCreated(room *Room) {
+	for _, hook := range rm.currentHooks().create {
+		hook(room)
+	}
+}
+
+func (rm *RoomManager) roomDeleted(room *Room) {
+	for _, hook := range rm.currentHooks().delete {
+		hook(room)
+	}
+}
+
+// deleteIfEmpty deletes room unless a socket joined it in the meantime
+func (rm *RoomManager) deleteIfEmpty(room *Room) {
+	rm.mu.Lock()
+	room.mu.Lock()
+	deletable := !room.deleted && len(room.sockets) == 0 && rm.rooms[room.name] == room
+	if deletable {
+		delete(rm.rooms, room.name)
+		room.deleted = true
+		room.stopDeleteTimer()
+	}
+
+	room.mu.Unlock()
+	rm.mu.Unlock()
+	if deletable {
+		rm.roomDeleted(room)
+	}
+}
+
+// markDeleted keeps sockets from joining a room removed from its manager. The
+// caller must hold the manager's lock.
+func (r *Room) markDeleted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted = true
+	r.stopDeleteTimer()
+}
+
+// stopDeleteTimer cancels a pending deletion. The caller must hold the lock.
+func (r *Room) stopDeleteTimer() {
+	if r.deleteTimer != nil {
+		r.deleteTimer.Stop()
+		r.deleteTimer = nil
+	}
+}
@@ -0,0 +1,345 @@
+package websocket
+
+import (
+	"slices"
+	"strings"
+)
+
+const (
+	// PresenceStateEvent carries the PresenceState of a room to a socket that
+	// sets its presence for the first time
+	PresenceStateEvent = "presence.state"
+	// PresenceJoinEvent, PresenceLeaveEvent and PresenceUpdateEvent carry a
+	// PresenceChange to the members of a room
+	PresenceJoinEvent   = "presence.join"
+	PresenceLeaveEvent  = "presence.leave"
+	PresenceUpdateEvent = "presence.update"
+)
+
+// PresenceEvents are the events presence is sent with. An empty event sends
+// nothing.
+type PresenceEvents struct {
+	State  string
+	Join   string
+	Leave  string
+	Update string
+}
+
+var DefaultPresenceEvents = PresenceEvents{
+	State:  PresenceStateEvent,
+	Join:   PresenceJoinEvent,
+	Leave:  PresenceLeaveEvent,
+	Update: PresenceUpdateEvent,
+}
+
+// Presence is a user present in a room. The sockets of one user share a
+// single entry, with the metadata set last by any of them.
+type Presence struct {
+	Key     string    `json:"key"`
+	Meta    any       `json:"meta"`
+	Sockets []*Socket `json:"-"`
+}
+
+// PresenceChange is the data of the presence join, leave and update events.
+// Events are sent after the room's presence is unlocked, so members may get
+// concurrent changes out of order: Version counts the presence changes of
+// the room, and a change older than the last one applied can be ignored.
+type PresenceChange struct {
+	Room    string `json:"room"`
+	Key     string `json:"key"`
+	Meta    any    `json:"meta"`
+	Version uint64 `json:"version"`
+}
+
+// PresenceState lists the users present in a room. Version is the version
+// of the last change it includes.
+type PresenceState struct {
+	Room    string      `json:"room"`
+	Members []*Presence `json:"members"`
+	Version uint64      `json:"version"`
+}
+
+type presenceEntry struct {
+	sockets map[*Socket]*socketPresence
+}
+
+// presenceMessage is presence sent once the presence lock is released, so a
+// slow member cannot hold up the room's presence
+type presenceMessage struct {
+	event   string
+	data    any
+	sockets []*Socket
+	except  map[string]bool
+}
+
+type socketPresence struct {
+	key  string
+	meta any
+	seq  uint64
+}
+
+// SetPresenceKey sets the function that tells which user a socket belongs
+// to. Sockets with the same key are one presence entry. It defaults to the
+// socket ID.
+func (rm *RoomManager) SetPresenceKey(key func(socket *Socket) string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.presenceKey = key
+}
+
+func WithPresenceKey(key func(socket *Socket) string) ServerOption {
+	return func(s *Server) {
+		s.roomManager.SetPresenceKey(key)
+	}
+}
+
+// SetPresenceEvents sets the events presence is sent with, which default to
+// DefaultPresenceEvents. Presence is kept by each server: with an adapter,
+// the events only reach the members connected to the server the user is
+// present on.
+func (rm *RoomManager) SetPresenceEvents(events PresenceEvents) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.presenceEvents = events
+}
+
+func WithPresenceEvents(events PresenceEvents) ServerOption {
+	return func(s *Server) {
+		s.roomManager.SetPresenceEvents(events)
+	}
+}
+
+func (rm *RoomManager) currentPresenceEvents() PresenceEvents {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.presenceEvents
+}
+
+func (rm *RoomManager) presenceKeyOf(socket *Socket) string {
+	rm.mu.RLock()
+	key := rm.presenceKey
+	rm.mu.RUnlock()
+	if key == nil {
+		return socket.ID()
+	}
+
+	return key(socket)
+}
+
+// SetPresence makes the socket present in a room it joined, with meta such as
+// the name or status of its user. The first call sends the socket the
+// PresenceState of the room; the other members get a presence join or
+// update event. The socket's presence ends when it leaves the room.
+func (s *Socket) SetPresence(roomName string, meta any) error {
+	s.roomsMx.RLock()
+	room := s.rooms[roomName]
+	s.roomsMx.RUnlock()
+	if room == nil {
+		return ErrNotInRoom
+	}
+
+	return room.setPresence(s, meta)
+}
+
+func (c *Context) SetPresence(roomName string, meta any) error {
+	if c.socket == nil {
+		return ErrContextFreed
+	}
+
+	return c.socket.SetPresence(roomName, meta)
+}
+
+// Presence returns the users present in the room, ordered by key
+func (r *Room) Presence() []*Presence {
+	r.presenceMu.Lock()
+	defer r.presenceMu.Unlock()
+	return r.presenceList()
+}
+
+// presenceList builds the presence of every user. The caller must hold the
+// presence lock.
+func (r *Room) presenceList() []*Presence {
+	members := make([]*Presence, 0, len(r.presence))
+	for key, entry := range r.presence {
+		presence := &Presence{Key: key, Meta: entry.meta()}
+		for socket := range entry.sockets {
+			presence.Sockets = append(presence.Sockets, socket)
+		}
+
+		members = append(members, presence)
+	}
+
+	slices.SortFunc(members, func(a, b *Presence) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return members
+}
+
+func (r *Room) setPresence(socket *Socket, meta any) error {
+	messages, err := r.storePresence(socket, meta)
+	if err != nil {
+		return err
+	}
+
+	r.sendPresence(messages)
+	return nil
+}
+
+// storePresence sets the presence of socket and returns the messages that
+// tell the members about it
+func (r *Room) storePresence(socket *Socket, meta any) ([]presenceMessage, error) {
+	r.presenceMu.Lock()
+	defer r.presenceMu.Unlock()
+	if !r.Has(socket) {
+		return nil, ErrNotInRoom
+	}
+
+	var messages []presenceMessage
+	key := r.manager.presenceKeyOf(socket)
+	if previous, ok := r.presenceOf(socket); ok && previous.key != key {
+		messages = append(messages, r.removePresenceLocked(socket)...)
+	}
+
+	if r.presence == nil {
+		r.presence = map[string]*presenceEntry{}
+	}
+
+	entry, exists := r.presence[key]
+	if !exists {
+		entry = &presenceEntry{sockets: map[*Socket]*socketPresence{}}
+		r.presence[key] = entry
+	}
+
+	_, present := entry.sockets[socket]
+	r.presenceSeq++
+	entry.sockets[socket] = &socketPresence{key: key, meta: meta, seq: r.presenceSeq}
+
+	events := r.manager.currentPresenceEvents()
+	event := events.Update
+	if !exists {
+		event = events.Join
+	}
+
+	except := map[string]bool{}
+	if !present {
+		// The socket learns about itself from the state
+		except[socket.ID()] = true
+		messages = append(messages, presenceMessage{
+			event:   events.State,
+			data:    &PresenceState{Room: r.name, Members: r.presenceList(), Version: r.presenceSeq},
+			sockets: []*Socket{socket},
+		})
+	}
+
+	messages = append(messages, presenceMessage{
+		event:   event,
+		data:    &PresenceChange{Room: r.name, Key: key, Meta: meta, Version: r.presenceSeq},
+		sockets: r.Sockets(),
+		except:  except,
+	})
+
+	return messages, nil
+}
+
+// removePresence ends the presence of a socket that left the room
+func (r *Room) removePresence(socket *Socket) {
+	r.presenceMu.Lock()
+	messages := r.removePresenceLocked(socket)
+	r.presenceMu.Unlock()
+	r.sendPresence(messages)
+}
+
+// removePresenceLocked removes the socket's presence and returns the message
+// telling the members that its user left, or that its metadata changed if
+// the user has other sockets in the room. The caller must hold the presence
+// lock.
+func (r *Room) removePresenceLocked(socket *Socket) []presenceMessage {
+	current, ok := r.presenceOf(socket)
+	if !ok {
+		return nil
+	}
+
+	events := r.manager.currentPresenceEvents()
+	entry := r.presence[current.key]
+	before := entry.latest()
+	delete(entry.sockets, socket)
+	if len(entry.sockets) == 0 {
+		delete(r.presence, current.key)
+		r.presenceSeq++
+		return []presenceMessage{{
+			event:   events.Leave,
+			data:    &PresenceChange{Room: r.name, Key: current.key, Meta: current.meta, Version: r.presenceSeq},
+			sockets: r.Sockets(),
+		}}
+	}
+
+	if before != current {
+		return nil
+	}
+
+	r.presenceSeq++
+	return []presenceMessage{{
+		event:   events.Update,
+		data:    &PresenceChange{Room: r.name, Key: current.key, Meta: entry.meta(), Version: r.presenceSeq},
+		sockets: r.Sockets(),
+	}}
+}
+
+// replacePresence hands the presence of a dropped socket to the socket that
+// resumed its session
+func (r *Room) replacePresence(previous *Socket, socket *Socket) {
+	r.presenceMu.Lock()
+	defer r.presenceMu.Unlock()
+	current, ok := r.presenceOf(previous)
+	if !ok {
+		return
+	}
+
+	entry := r.presence[current.key]
+	delete(entry.sockets, previous)
+	entry.sockets[socket] = current
+}
+
+// presenceOf returns the presence of socket. The caller must hold the
+// presence lock.
+func (r *Room) presenceOf(socket *Socket) (*socketPresence, bool) {
+	for _, entry := range r.presence {
+		if presence, ok := entry.sockets[socket]; ok {
+			return presence, true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *Room) sendPresence(messages []presenceMessage) {
+	for _, msg := range messages {
+		if msg.event == "" {
+			continue
+		}
+
+		f := r.manager.fanout(&OutboundMessage{Event: msg.event, Data: msg.data})
+		f.sendToAll(r.manager, msg.sockets, msg.except)
+	}
+}
+
+// latest returns the presence set last by one of the user's sockets
+func (e *presenceEntry) latest() *socketPresence {
+	var latest *socketPresence
+	for _, presence := range e.sockets {
+		if latest == nil || presence.seq > latest.seq {
+			latest = presence
+		}
+	}
+
+	return latest
+}
+
+func (e *presenceEntry) meta() any {
+	if latest := e.latest(); latest != nil {
+		return latest.meta
+	}
+
+	return nil
+}
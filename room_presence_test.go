@@ -0,0 +1,122 @@
+package websocket_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+type presenceChange struct {
+	Room    string `json:"room"`
+	Key     string `json:"key"`
+	Version uint64 `json:"version"`
+}
+
+type presenceState struct {
+	Version uint64 `json:"version"`
+}
+
+func TestPresenceEvents(t *testing.T) {
+	server := newJSONServer(t, ws.WithPresenceEvents(ws.PresenceEvents{
+		State: "members",
+		Join:  "member.joined",
+		Leave: "member.left",
+	}))
+
+	alice := wstest.NewClient(t, server)
+	bob := wstest.NewClient(t, server)
+	for _, client := range []*wstest.TestClient{alice, bob} {
+		client.Socket().Join("lobby")
+		if err := client.Socket().SetPresence("lobby", "online"); err != nil {
+			t.Fatal(err)
+		}
+
+		client.ExpectEvent("members")
+	}
+
+	var change presenceChange
+	if err := alice.ExpectEvent("member.joined").Unmarshal(&change); err != nil || change.Key != bob.SocketID() {
+		t.Fatalf("join = %+v, %v", change, err)
+	}
+
+	// Updates have no event
+	bob.Socket().SetPresence("lobby", "away")
+	alice.ExpectNoMessage(20 * time.Millisecond)
+
+	bob.Socket().Leave("lobby")
+	if err := alice.ExpectEvent("member.left").Unmarshal(&change); err != nil || change.Key != bob.SocketID() {
+		t.Fatalf("leave = %+v, %v", change, err)
+	}
+
+	if members := server.Rooms().GetRoom("lobby").Presence(); len(members) != 1 || members[0].Key != alice.SocketID() {
+		t.Fatalf("presence = %+v, want alice only", members)
+	}
+}
+
+func TestPresenceVersions(t *testing.T) {
+	server := newJSONServer(t)
+	alice := wstest.NewClient(t, server)
+	bob := wstest.NewClient(t, server)
+	alice.Socket().Join("lobby")
+	bob.Socket().Join("lobby")
+
+	alice.Socket().SetPresence("lobby", "online")
+	var state presenceState
+	if err := alice.ExpectEvent(ws.PresenceStateEvent).Unmarshal(&state); err != nil || state.Version != 1 {
+		t.Fatalf("state = %+v, %v, want version 1", state, err)
+	}
+
+	bob.Socket().SetPresence("lobby", "online")
+	bob.Socket().SetPresence("lobby", "away")
+	bob.Socket().Leave("lobby")
+	for _, want := range []struct {
+		event   string
+		version uint64
+	}{
+		{ws.PresenceJoinEvent, 2},
+		{ws.PresenceUpdateEvent, 3},
+		{ws.PresenceLeaveEvent, 4},
+	} {
+		var change presenceChange
+		if err := alice.ExpectEvent(want.event).Unmarshal(&change); err != nil || change.Version != want.version {
+			t.Fatalf("%s = %+v, %v, want version %d", want.event, change, err, want.version)
+		}
+	}
+}
+
+func TestPresenceIsSentOutsideTheLock(t *testing.T) {
+	server := newJSONServer(t)
+	serverConn, _ := wstest.Pipe()
+	conn := &stalledConn{
+		Conn:    serverConn,
+		writing: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+
+	stalled := handle(t, server, conn)
+	stalled.Join("lobby")
+	alice := wstest.NewClient(t, server)
+	alice.Socket().Join("lobby")
+	// Runs before the clients close, which sends them the leave event
+	t.Cleanup(conn.unblock)
+
+	// The join event for the stalled member blocks the sender
+	go alice.Socket().SetPresence("lobby", "online")
+	<-conn.writing
+
+	presence := make(chan []*ws.Presence, 1)
+	go func() {
+		presence <- server.Rooms().GetRoom("lobby").Presence()
+	}()
+
+	select {
+	case members := <-presence:
+		if len(members) != 1 || members[0].Key != alice.SocketID() {
+			t.Fatalf("presence = %+v, want alice", members)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a stalled member holds the room's presence lock")
+	}
+}
@@ -0,0 +1,166 @@
+package websocket
+
+import (
+	"maps"
+	"reflect"
+)
+
+// RoomStateChange is sent to the members of a room when one of its values
+// changes. Changes are sent after the room's state is unlocked, so members
+// may get concurrent changes out of order: Version counts the changes of the
+// room, and a change older than the last one applied can be ignored.
+type RoomStateChange struct {
+	Room    string `json:"room"`
+	Key     string `json:"key"`
+	Value   any    `json:"value"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Version uint64 `json:"version"`
+}
+
+// RoomStateSnapshot is sent to a socket that joins a room. Version is the
+// version of the last change it includes.
+type RoomStateSnapshot struct {
+	Room    string         `json:"room"`
+	State   map[string]any `json:"state"`
+	Version uint64         `json:"version"`
+}
+
+// SetStateEvents sets the events the members of rooms get when a room value
+// changes and when they join a room, with a RoomStateChange and a
+// RoomStateSnapshot as data. An empty event sends nothing, which is the
+// default. The messages are encoded with the codec of each socket, or the
+// server's codec. State is kept by each server: with an adapter, the events
+// only reach the members connected to the server whose room changed.
+func (rm *RoomManager) SetStateEvents(change, snapshot string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.stateChangeEvent = change
+	rm.stateSnapshotEvent = snapshot
+}
+
+func WithRoomStateEvents(change, snapshot string) ServerOption {
+	return func(s *Server) {
+		s.roomManager.SetStateEvents(change, snapshot)
+	}
+}
+
+func (rm *RoomManager) stateEvents() (string, string) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.stateChangeEvent, rm.stateSnapshotEvent
+}
+
+// Get returns the room value stored under key. Values are shared between
+// callers and must not be modified; store a new value instead.
+func (r *Room) Get(key string) (any, bool) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	value, ok := r.state[key]
+	return value, ok
+}
+
+// State returns a copy of every value of the room
+func (r *Room) State() map[string]any {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+	return maps.Clone(r.state)
+}
+
+// Set stores value under key. Values are kept until the room is deleted.
+func (r *Room) Set(key string, value any) {
+	r.stateMu.Lock()
+	change := r.store(key, value)
+	r.stateMu.Unlock()
+	r.stateChanged(change)
+}
+
+// Delete removes the value stored under key
+func (r *Room) Delete(key string) {
+	r.stateMu.Lock()
+	if _, ok := r.state[key]; !ok {
+		r.stateMu.Unlock()
+		return
+	}
+
+	delete(r.state, key)
+	r.stateSeq++
+	change := &RoomStateChange{Room: r.name, Key: key, Deleted: true, Version: r.stateSeq}
+	r.stateMu.Unlock()
+	r.stateChanged(change)
+}
+
+// CompareAndSwap stores value under key if the current value is old, as
+// compared by reflect.DeepEqual. A nil old matches a missing key.
+func (r *Room) CompareAndSwap(key string, old, value any) bool {
+	r.stateMu.Lock()
+	if !reflect.DeepEqual(r.state[key], old) {
+		r.stateMu.Unlock()
+		return false
+	}
+
+	change := r.store(key, value)
+	r.stateMu.Unlock()
+	r.stateChanged(change)
+	return true
+}
+
+// Update atomically replaces the value under key with the one fn returns. fn
+// gets the current value and whether there is one, and returns false to
+// leave it unchanged. It must not call the state methods of the room. Update
+// returns the value stored under key afterwards.
+func (r *Room) Update(key string, fn func(value any, ok bool) (any, bool)) any {
+	r.stateMu.Lock()
+	current, ok := r.state[key]
+	value, changed := fn(current, ok)
+	if !changed {
+		r.stateMu.Unlock()
+		return current
+	}
+
+	change := r.store(key, value)
+	r.stateMu.Unlock()
+	r.stateChanged(change)
+	return value
+}
+
+// store sets a value and returns the change to send to the members once the
+// state is unlocked. The caller must hold the state lock.
+func (r *Room) store(key string, value any) *RoomStateChange {
+	if r.state == nil {
+		r.state = map[string]any{}
+	}
+
+	r.state[key] = value
+	r.stateSeq++
+	return &RoomStateChange{Room: r.name, Key: key, Value: value, Version: r.stateSeq}
+}
+
+func (r *Room) stateChanged(change *RoomStateChange) {
+	event, _ := r.manager.stateEvents()
+	if event == "" {
+		return
+	}
+
+	f := r.manager.fanout(&OutboundMessage{Event: event, Data: change})
+	f.sendToAll(r.manager, r.Sockets(), nil)
+}
+
+// sendSnapshot sends the room's values to a socket that joined it
+func (r *Room) sendSnapshot(socket *Socket) {
+	_, event := r.manager.stateEvents()
+	if event == "" {
+		return
+	}
+
+	r.stateMu.Lock()
+	snapshot := &RoomStateSnapshot{Room: r.name, State: maps.Clone(r.state), Version: r.stateSeq}
+	r.stateMu.Unlock()
+	if snapshot.State == nil {
+		snapshot.State = map[string]any{}
+	}
+
+	f := r.manager.fanout(&OutboundMessage{Event: event, Data: snapshot})
+	if err := f.sendTo(socket); err != nil && r.manager.logger != nil {
+		r.manager.logger.WithError(err).WithField("socketId", socket.ID()).Warn("Failed to send room state")
+	}
+}
@@ -0,0 +1,75 @@
+package websocket_test
+
+import (
+	"testing"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+type stateChange struct {
+	Key     string `json:"key"`
+	Value   any    `json:"value"`
+	Deleted bool   `json:"deleted"`
+	Version uint64 `json:"version"`
+}
+
+type stateSnapshot struct {
+	State   map[string]any `json:"state"`
+	Version uint64         `json:"version"`
+}
+
+func TestRoomCompareAndSwapUncomparable(t *testing.T) {
+	room := ws.NewServer().Rooms().Room("lobby")
+	if !room.CompareAndSwap("players", nil, []string{"alice"}) {
+		t.Fatal("swap of a missing key failed")
+	}
+
+	if room.CompareAndSwap("players", []string{"bob"}, []string{"carol"}) {
+		t.Fatal("swap succeeded with a different old value")
+	}
+
+	if !room.CompareAndSwap("players", []string{"alice"}, map[string]int{"alice": 1}) {
+		t.Fatal("swap failed with an equal slice")
+	}
+
+	if !room.CompareAndSwap("players", map[string]int{"alice": 1}, nil) {
+		t.Fatal("swap failed with an equal map")
+	}
+}
+
+func TestRoomStateEvents(t *testing.T) {
+	server := newJSONServer(t, ws.WithRoomStateEvents("room.state", "room.snapshot"))
+	room := server.Rooms().Room("lobby")
+	room.Set("topic", "Go")
+
+	client := wstest.NewClient(t, server)
+	client.Socket().Join("lobby")
+	var snapshot stateSnapshot
+	if err := client.ExpectEvent("room.snapshot").Unmarshal(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot.State["topic"] != "Go" || snapshot.Version != 1 {
+		t.Fatalf("snapshot = %+v, want topic Go at version 1", snapshot)
+	}
+
+	room.Update("score", func(value any, ok bool) (any, bool) {
+		return 1, !ok
+	})
+
+	room.Delete("topic")
+	for _, want := range []stateChange{
+		{Key: "score", Value: float64(1), Version: 2},
+		{Key: "topic", Deleted: true, Version: 3},
+	} {
+		var change stateChange
+		if err := client.ExpectEvent("room.state").Unmarshal(&change); err != nil {
+			t.Fatal(err)
+		}
+
+		if change != want {
+			t.Fatalf("change = %+v, want %+v", change, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package websocket
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Router indexes handler nodes by their patterns in a segment trie so that
+// finding the nodes for an event costs time proportional to the event's
+// depth rather than the number of registrations. Matching nodes are always
+// run in the order they were added, which keeps middleware registered with
+// Server.Use in front of the handlers registered after it.
+type Router struct {
+	root  *routeNode
+	first *HandlerNode
+	last  *HandlerNode
+	// always holds nodes without a pattern, which match every event.
+	always []*HandlerNode
+	// empty holds the matches of the empty event, the event of every message
+	// until a codec sets one. It is kept by the patterns themselves since the
+	// segments of the trie cannot tell an empty event from an empty segment.
+	empty []routeMatch
+	size  int
+}
+
+type routeNode struct {
+	chunk    chunk
+	static   map[string]*routeNode
+	children []*routeNode
+	nodes    []*HandlerNode
+}
+
+type routeMatch struct {
+	node   *HandlerNode
+	params map[string]string
+}
+
+func NewRouter() *Router {
+	return &Router{root: &routeNode{}}
+}
+
+// Add appends a handler node to the router. The node's Next field is linked
+// to keep the nodes usable as a plain list.
+func (r *Router) Add(node *HandlerNode) {
+	node.index = r.size
+	r.size++
+	if r.first == nil {
+		r.first = node
+	} else {
+		r.last.Next = node
+	}
+
+	r.last = node
+	if node.Pattern == nil {
+		r.always = append(r.always, node)
+		r.empty = append(r.empty, routeMatch{node: node})
+		return
+	}
+
+	if params, ok := node.Pattern.MatchParams(""); ok {
+		r.empty = append(r.empty, routeMatch{node: node, params: params})
+	}
+
+	current := r.root
+	for _, ch := range node.Pattern.chunks {
+		current = current.child(ch)
+	}
+
+	current.nodes = append(current.nodes, node)
+}
+
+// First returns the first node added to the router
+func (r *Router) First() *HandlerNode {
+	return r.first
+}
+
+// Len returns the number of nodes added to the router
+func (r *Router) Len() int {
+	return r.size
+}
+
+func (n *routeNode) child(ch chunk) *routeNode {
+	if ch.kind == static {
+		if n.static == nil {
+			n.static = map[string]*routeNode{}
+		}
+
+		child, ok := n.static[ch.literal]
+		if !ok {
+			child = &routeNode{chunk: ch}
+			n.static[ch.literal] = child
+		}
+
+		return child
+	}
+
+	for _, child := range n.children {
+		if child.chunk.kind == ch.kind && child.chunk.modifier == ch.modifier && child.chunk.key == ch.key {
+			return child
+		}
+	}
+
+	child := &routeNode{chunk: ch}
+	n.children = append(n.children, child)
+	sort.SliceStable(n.children, func(i, j int) bool {
+		return routePrecedence(n.children[i].chunk) < routePrecedence(n.children[j].chunk)
+	})
+
+	return child
+}
+
+// routePrecedence orders the non-static children of a trie node: named
+// parameters are tried before single wildcards, which are tried before deep
+// wildcards.
+func routePrecedence(ch chunk) int {
+	switch {
+	case ch.kind == dynamic && ch.modifier == single:
+		return 0
+	case ch.kind == dynamic && ch.modifier == optional:
+		return 1
+	case ch.kind == dynamic:
+		return 2
+	case ch.modifier == single:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// match returns every node matching the event, sorted by registration order
+func (r *Router) match(event string) []routeMatch {
+	if event == "" {
+		return slices.Clone(r.empty)
+	}
+
+	matcher := routeMatcher{
+		segments: strings.Split(event, "."),
+	}
+
+	for _, node := range r.always {
+		matcher.add(node)
+	}
+
+	matcher.walk(r.root, 0)
+
+	sort.Slice(matcher.matches, func(i, j int) bool {
+		return matcher.matches[i].node.index < matcher.matches[j].node.index
+	})
+
+	return matcher.matches
+}
+
+type routeMatcher struct {
+	segments []string
+	keys     []string
+	values   []string
+	matches  []routeMatch
+}
+
+func (m *routeMatcher) add(node *HandlerNode) {
+	for _, existing := range m.matches {
+		if existing.node == node {
+			return
+		}
+	}
+
+	var params map[string]string
+	if len(m.keys) > 0 {
+		params = make(map[string]string, len(m.keys))
+		for i, key := range m.keys {
+			params[key] = m.values[i]
+		}
+	}
+
+	m.matches = append(m.matches, routeMatch{node: node, params: params})
+}
+
+func (m *routeMatcher) walk(n *routeNode, pos int) {
+	if pos == len(m.segments) {
+		for _, node := range n.nodes {
+			m.add(node)
+		}
+	}
+
+	if pos < len(m.segments) && n.static != nil {
+		if child, ok := n.static[m.segments[pos]]; ok {
+			m.walk(child, pos+1)
+		}
+	}
+
+	for _, child := range n.children {
+		m.walkChild(child, pos)
+	}
+}
+
+// walkChild consumes the segments a non-static chunk can span. Longer spans
+// are tried first, mirroring the greedy regular expression of the pattern.
+func (m *routeMatcher) walkChild(child *routeNode, pos int) {
+	remaining := len(m.segments) - pos
+	switch {
+	case child.chunk.modifier == zeroOrMore:
+		for end := len(m.segments); end > pos; end-- {
+			m.walk(child, end)
+		}
+	case child.chunk.modifier == oneOrMore:
+		end := pos
+		for end < len(m.segments) && m.segments[end] != "" {
+			end++
+		}
+
+		for ; end > pos; end-- {
+			m.walkParam(child, pos, end)
+		}
+	case child.chunk.modifier == optional:
+		if remaining > 0 && m.segments[pos] != "" {
+			m.walkParam(child, pos, pos+1)
+		}
+
+		m.walk(child, pos)
+	default:
+		if remaining > 0 && m.segments[pos] != "" {
+			m.walkParam(child, pos, pos+1)
+		}
+	}
+}
+
+func (m *routeMatcher) walkParam(child *routeNode, start, end int) {
+	if child.chunk.kind != dynamic {
+		m.walk(child, end)
+		return
+	}
+
+	m.keys = append(m.keys, child.chunk.key)
+	m.values = append(m.values, strings.Join(m.segments[start:end], "."))
+	m.walk(child, end)
+	m.keys = m.keys[:len(m.keys)-1]
+	m.values = m.values[:len(m.values)-1]
+}
@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"fmt"
+	"maps"
+	"testing"
+)
+
+var routerPatterns = []string{
+	"chat",
+	"chat.message",
+	"chat.:room",
+	"chat.:room.message",
+	"chat.*",
+	"chat.**",
+	"user.:id?",
+	"user.:id?.profile",
+	"files.:path+",
+	"files.:path+.meta",
+	"game.**",
+	"game.*.move",
+	"**",
+	":a?",
+	":a?.:b?",
+	":a?.b",
+	"",
+	"price$",
+	"a.b+c",
+	"x.(y)",
+	"x.y",
+	":q?.**",
+	":s?.**.:q?",
+	":s?",
+	":q?",
+}
+
+var routerEvents = []string{
+	"",
+	"chat",
+	"chat.message",
+	"chat.lobby",
+	"chat.lobby.message",
+	"chat.lobby.other.message",
+	"chat.",
+	"user",
+	"user.42",
+	"user.42.profile",
+	"user.profile",
+	"files.a",
+	"files.a.b.c",
+	"files.a.b.meta",
+	"files",
+	"game",
+	"game.p1.move",
+	"game.p1.p2.move",
+	"b",
+	"x.b",
+	"x",
+	"x.y",
+	"x.(y)",
+	"price$",
+	"price",
+	"a.b+c",
+	"a.bbc",
+	"..",
+}
+
+func newTestRouter(tb testing.TB, patterns []string) *Router {
+	tb.Helper()
+	router := NewRouter()
+	for _, patternStr := range patterns {
+		pattern, err := NewPattern(patternStr)
+		if err != nil {
+			tb.Fatalf("NewPattern(%q): %v", patternStr, err)
+		}
+
+		router.Add(&HandlerNode{Pattern: pattern})
+	}
+
+	return router
+}
+
+// linearMatch finds the nodes matching event by trying every node in turn,
+// the way contexts without a router do
+func linearMatch(first *HandlerNode, event string) []routeMatch {
+	var matches []routeMatch
+	for node := first; node != nil; node = node.Next {
+		if node.Pattern == nil {
+			matches = append(matches, routeMatch{node: node})
+			continue
+		}
+
+		if params, ok := node.Pattern.MatchParams(event); ok {
+			matches = append(matches, routeMatch{node: node, params: params})
+		}
+	}
+
+	return matches
+}
+
+func TestRouterMatchesPatterns(t *testing.T) {
+	router := newTestRouter(t, routerPatterns)
+	router.Add(&HandlerNode{})
+	checkRouterParity(t, router, routerEvents)
+}
+
+// Found by fuzzing: deep wildcards after an optional parameter do not match
+// the empty event
+func TestRouterMatchesEmptyEvent(t *testing.T) {
+	router := newTestRouter(t, []string{":q?.**", "**", ":s?", ":q?"})
+	checkRouterParity(t, router, []string{"", "a", "a.b"})
+	if got := describeMatches(router.match("")); got != `["**" ":s?" ":q?"]` {
+		t.Fatalf("empty event matched %s", got)
+	}
+}
+
+func checkRouterParity(t *testing.T, router *Router, events []string) {
+	t.Helper()
+	for _, event := range events {
+		want := linearMatch(router.First(), event)
+		got := router.match(event)
+		if len(got) != len(want) {
+			t.Errorf("event %q: router matched %s, patterns matched %s", event, describeMatches(got), describeMatches(want))
+			continue
+		}
+
+		for i := range want {
+			if got[i].node != want[i].node {
+				t.Errorf("event %q: router matched %s, patterns matched %s", event, describeMatches(got), describeMatches(want))
+				break
+			}
+
+			if len(got[i].params)+len(want[i].params) > 0 && !maps.Equal(got[i].params, want[i].params) {
+				t.Errorf("event %q, pattern %q: router params %v, pattern params %v", event, want[i].node.Pattern, got[i].params, want[i].params)
+			}
+		}
+	}
+}
+
+func describeMatches(matches []routeMatch) string {
+	patterns := make([]string, len(matches))
+	for i, match := range matches {
+		patterns[i] = fmt.Sprintf("%q", match.node.Pattern)
+	}
+
+	return fmt.Sprint(patterns)
+}
+
+func BenchmarkRouter(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		patterns := make([]string, 0, size)
+		for i := 0; i < size; i++ {
+			switch i % 4 {
+			case 0:
+				patterns = append(patterns, fmt.Sprintf("service%d.create", i))
+			case 1:
+				patterns = append(patterns, fmt.Sprintf("service%d.:id.update", i))
+			case 2:
+				patterns = append(patterns, fmt.Sprintf("service%d.*", i))
+			default:
+				patterns = append(patterns, fmt.Sprintf("service%d.**", i))
+			}
+		}
+
+		router := newTestRouter(b, patterns)
+		event := fmt.Sprintf("service%d.42.update", size-3)
+		b.Run(fmt.Sprintf("trie/%d", size), func(b *testing.B) {
+			for b.Loop() {
+				router.match(event)
+			}
+		})
+
+		b.Run(fmt.Sprintf("list/%d", size), func(b *testing.B) {
+			for b.Loop() {
+				linearMatch(router.First(), event)
+			}
+		})
+	}
+}
+
+func FuzzRouterParity(f *testing.F) {
+	for _, pattern := range routerPatterns {
+		f.Add(pattern, "")
+	}
+
+	for _, event := range routerEvents {
+		f.Add(":a?.**", event)
+	}
+
+	f.Fuzz(func(t *testing.T, patternStr string, event string) {
+		pattern, err := NewPattern(patternStr)
+		if err != nil {
+			t.Skip()
+		}
+
+		router := NewRouter()
+		router.Add(&HandlerNode{Pattern: pattern})
+		checkRouterParity(t, router, []string{event})
+	})
+}
@@ -1,23 +1,51 @@
 package websocket
 
 import (
+	"errors"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/coder/websocket"
 	"github.com/sirupsen/logrus"
 )
 
 type Server struct {
-	firstHandlerNode      *HandlerNode
-	lastHandlerNode       *HandlerNode
+	router                *Router
 	firstOpenHandlerNode  *HandlerNode
 	lastOpenHandlerNode   *HandlerNode
 	firstCloseHandlerNode *HandlerNode
 	lastCloseHandlerNode  *HandlerNode
 	origins               []string
+	upgradeHandler        UpgradeHandler
+	validator             Validator
+	errorHandler          ErrorHandler
+	codec                 Codec
+	subprotocols          []string
+	insecureSkipVerify    bool
+	compressionMode       CompressionMode
+	compressionThreshold  int
+	readLimit             int64
+	pingInterval          time.Duration
+	pongTimeout           time.Duration
+	idleTimeout           time.Duration
+	sessions              *sessionManager
 	logger                *logrus.Logger
+	processingMode        ProcessingMode
+	outboundQueueSize     int
+	overflowPolicy        OverflowPolicy
 	roomManager           *RoomManager
+	socketsMu             sync.RWMutex
+	sockets               map[string]*Socket
+	lifecycleMu           sync.Mutex
+	shuttingDown          bool
+	shutdownStatus        Status
+	shutdownReason        string
+	connections           activity
+	handlers              activity
 }
 
 var _ http.Handler = &Server{}
@@ -25,12 +53,22 @@ var _ Handler = &Server{}
 var _ OpenHandler = &Server{}
 var _ CloseHandler = &Server{}
 
-func NewServer() *Server {
+func NewServer(opts ...ServerOption) *Server {
 	logger := logrus.New()
-	return &Server{
+	s := &Server{
+		router:      NewRouter(),
 		logger:      logger,
 		roomManager: NewRoomManager(logger),
+		sockets:     make(map[string]*Socket),
 	}
+
+	s.roomManager.localSockets = s.Sockets
+	s.roomManager.localSocket = s.Socket
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 func (s *Server) SetLogger(logger *logrus.Logger) {
@@ -40,11 +78,26 @@ func (s *Server) SetLogger(logger *logrus.Logger) {
 	}
 }
 
+// SetAdapter connects the server's rooms to other server instances. It must
+// be called before the server accepts connections.
+func (s *Server) SetAdapter(adapter Adapter) error {
+	return s.roomManager.SetAdapter(adapter)
+}
+
 func (s *Server) SetOrigins(origins []string) {
 	s.origins = origins
 }
 
 func (s *Server) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if s.IsShuttingDown() {
+		res.WriteHeader(http.StatusServiceUnavailable)
+		if _, err := res.Write([]byte("Service Unavailable. Server is shutting down")); err != nil {
+			s.logger.WithError(err).Error("failed to write error response")
+		}
+
+		return
+	}
+
 	if s.isWebsocketUpgradeRequest(req) {
 		s.handleWebsocketConnection(res, req)
 		return
@@ -61,27 +114,132 @@ type ConnectionInfo struct {
 	RemoteAddr string
 	Headers    http.Header
 	Query      map[string]string // Query parameters from the connection URL
+	// Subprotocol is the subprotocol negotiated during the handshake, if any
+	Subprotocol string
 }
 
 func (s *Server) HandleConnection(info *ConnectionInfo, connection SocketConnection) {
+	s.serveConnection(info, connection, nil, nil)
+}
+
+func (s *Server) serveConnection(info *ConnectionInfo, connection SocketConnection, values map[string]any, resume *resumption) {
 	socket := NewSocket(info, connection)
+	for key, value := range values {
+		socket.Set(key, value)
+	}
+
 	socket.SetRoomManager(s.roomManager)
+	socket.server = s
+	socket.setProcessingMode(s.processingMode)
+	socket.startWriter(s.outboundQueueSize, s.overflowPolicy)
+	if resume != nil {
+		socket.adopt(resume)
+	}
+
+	if !s.acceptConnection(socket) {
+		socket.stopWriter(false)
+		if resume != nil {
+			s.abandonSession(resume)
+		}
+
+		if err := connection.Close(s.shutdownStatus, s.shutdownReason); err != nil && !errors.Is(err, net.ErrClosed) {
+			s.logger.WithError(err).Error("failed to close connection")
+		}
+
+		return
+	}
+
+	defer s.connections.end()
+	if resume != nil && resume.resumed {
+		s.resumeSession(socket, resume)
+	} else {
+		socket.runWriter(nil)
+	}
+
+	go socket.keepalive(s.pingInterval, s.pongTimeout, s.idleTimeout)
 	socket.HandleOpen(s.firstOpenHandlerNode)
-	for socket.HandleNextMessageWithNode(s.firstHandlerNode) {
+	for socket.HandleNextMessageWithRouter(s.router) {
 	}
 
-	socket.HandleClose(s.firstCloseHandlerNode)
-	socket.leaveAllRooms()
+	if s.detachSession(socket) {
+		return
+	}
+
+	s.finishSocket(socket)
 	socket.closeMu.Lock()
 	defer socket.closeMu.Unlock()
-	if err := connection.Close(socket.closeStatus, socket.closeReason); err != nil {
+	if socket.closeStatusSource == ServerCloseSource {
+		return
+	}
+
+	if err := connection.Close(socket.closeStatus, socket.closeReason); err != nil && !errors.Is(err, net.ErrClosed) {
 		s.logger.WithError(err).Error("failed to close connection")
 	}
 }
 
+// finishSocket unregisters a closed socket, runs its close handlers and
+// removes it from its rooms
+func (s *Server) finishSocket(socket *Socket) {
+	s.removeSocket(socket)
+	socket.HandleClose(s.firstCloseHandlerNode)
+	socket.leaveAllRooms()
+	socket.stopWriter(false)
+}
+
+// Sockets returns every socket currently connected to the server
+func (s *Server) Sockets() []*Socket {
+	s.socketsMu.RLock()
+	defer s.socketsMu.RUnlock()
+	sockets := make([]*Socket, 0, len(s.sockets))
+	for _, socket := range s.sockets {
+		sockets = append(sockets, socket)
+	}
+
+	return sockets
+}
+
+// Socket returns the connected socket with the given ID, or nil
+func (s *Server) Socket(id string) *Socket {
+	s.socketsMu.RLock()
+	defer s.socketsMu.RUnlock()
+	return s.sockets[id]
+}
+
+// SocketCount returns the number of sockets currently connected to the server
+func (s *Server) SocketCount() int {
+	s.socketsMu.RLock()
+	defer s.socketsMu.RUnlock()
+	return len(s.sockets)
+}
+
+func (s *Server) addSocket(socket *Socket) {
+	s.socketsMu.Lock()
+	s.sockets[socket.ID()] = socket
+	s.socketsMu.Unlock()
+	s.roomManager.notifyAdapter("add socket", func(adapter Adapter) error {
+		return adapter.AddSocket(socket.ID())
+	})
+}
+
+func (s *Server) removeSocket(socket *Socket) {
+	s.socketsMu.Lock()
+	removed := s.sockets[socket.ID()] == socket
+	if removed {
+		delete(s.sockets, socket.ID())
+	}
+	s.socketsMu.Unlock()
+	if removed {
+		s.roomManager.notifyAdapter("remove socket", func(adapter Adapter) error {
+			return adapter.RemoveSocket(socket.ID())
+		})
+	}
+}
+
 func (s *Server) Handle(ctx *Context) {
-	subCtx := NewSubContextWithNode(ctx, s.firstHandlerNode)
+	subCtx := NewSubContextWithRouter(ctx, s.router)
 	subCtx.Next()
+	s.handleError(subCtx)
+	ctx.errorHandled = subCtx.errorHandled
 	subCtx.free()
 	if subCtx.currentHandlerNode != nil {
 		ctx.Next()
@@ -192,19 +350,11 @@ func (s *Server) on(event string, handlers ...any) error {
 		}
 	}
 
-	nextHandlerNode := &HandlerNode{
+	s.router.Add(&HandlerNode{
 		BindType: NormalBindType,
 		Pattern:  pattern,
 		Handlers: handlers,
-	}
-
-	if s.firstHandlerNode == nil {
-		s.firstHandlerNode = nextHandlerNode
-		s.lastHandlerNode = nextHandlerNode
-	} else {
-		s.lastHandlerNode.Next = nextHandlerNode
-		s.lastHandlerNode = nextHandlerNode
-	}
+	})
 
 	return nil
 }
@@ -214,17 +364,30 @@ func (s *Server) isWebsocketUpgradeRequest(req *http.Request) bool {
 }
 
 func (s *Server) handleWebsocketConnection(res http.ResponseWriter, req *http.Request) {
-	origins := s.origins
-	if len(origins) == 0 {
-		origins = []string{"*"}
+	decision, ok := s.runUpgradeHandler(res, req)
+	if !ok {
+		return
 	}
 
-	conn, err := websocket.Accept(res, req, &websocket.AcceptOptions{
-		OriginPatterns: origins,
-	})
+	var resume *resumption
+	if s.sessions != nil {
+		resume = s.sessions.prepare(req)
+		res.Header().Set(SessionTokenHeader, resume.session.token)
+		res.Header().Set(SessionResumedHeader, strconv.FormatBool(resume.resumed))
+	}
 
+	opts := s.acceptOptions()
+	if decision.Subprotocol != "" {
+		opts.Subprotocols = []string{decision.Subprotocol}
+	}
+
+	conn, err := websocket.Accept(res, req, opts)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to accept websocket connection")
+		if resume != nil {
+			s.abandonSession(resume)
+		}
+
 		if conn != nil {
 			if closeErr := conn.Close(websocket.StatusInternalError, "failed to accept websocket connection"); closeErr != nil {
 				s.logger.WithError(closeErr).Error("failed to close connection after accept error")
@@ -234,6 +397,10 @@ func (s *Server) handleWebsocketConnection(res http.ResponseWriter, req *http.Re
 		return
 	}
 
+	if s.readLimit != 0 {
+		conn.SetReadLimit(s.readLimit)
+	}
+
 	// Extract query parameters
 	queryParams := make(map[string]string)
 	for key, values := range req.URL.Query() {
@@ -243,24 +410,11 @@ func (s *Server) handleWebsocketConnection(res http.ResponseWriter, req *http.Re
 	}
 
 	info := &ConnectionInfo{
-		RemoteAddr: req.RemoteAddr,
-		Headers:    req.Header,
-		Query:      queryParams,
-	}
-
-	socket := NewSocket(info, NewWebSocketConnection(conn))
-	socket.SetRoomManager(s.roomManager)
-	socket.HandleOpen(s.firstOpenHandlerNode)
-	for socket.HandleNextMessageWithNode(s.firstHandlerNode) {
+		RemoteAddr:  req.RemoteAddr,
+		Headers:     req.Header,
+		Query:       queryParams,
+		Subprotocol: conn.Subprotocol(),
 	}
 
-	socket.HandleClose(s.firstCloseHandlerNode)
-	socket.leaveAllRooms()
-	socket.closeMu.Lock()
-	closeStatus := socket.closeStatus
-	closeReason := socket.closeReason
-	socket.closeMu.Unlock()
-	if err := conn.Close(closeStatus, closeReason); err != nil {
-		s.logger.WithError(err).Error("failed to close websocket connection")
-	}
+	s.serveConnection(info, NewWebSocketConnection(conn), decision.Values, resume)
 }
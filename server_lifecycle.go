@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Shutdown gracefully stops the server. It rejects new connections, stops
+// handling new messages, waits for running message handlers to return,
+// closes every connected socket with StatusGoingAway and waits for their
+// close handlers to finish. Requests read while it drains are answered with
+// a retryable CodeUnavailable error. If ctx ends first, the remaining
+// sockets are still closed but Shutdown returns ctx's error without waiting
+// for them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.ShutdownWithStatus(ctx, StatusGoingAway, "server shutting down")
+}
+
+// ShutdownWithStatus is like Shutdown but closes sockets with the given
+// status and reason, e.g. StatusServiceRestart for rolling deploys.
+func (s *Server) ShutdownWithStatus(ctx context.Context, status Status, reason string) error {
+	s.lifecycleMu.Lock()
+	if !s.shuttingDown {
+		s.shuttingDown = true
+		s.shutdownStatus = status
+		s.shutdownReason = reason
+	}
+	s.lifecycleMu.Unlock()
+
+	err := s.handlers.wait(ctx)
+	s.expireSessions()
+	for _, socket := range s.Sockets() {
+		go socket.Close(status, reason, ServerCloseSource)
+	}
+
+	if waitErr := s.connections.wait(ctx); err == nil {
+		err = waitErr
+	}
+
+	return err
+}
+
+// IsShuttingDown reports whether Shutdown has been called
+func (s *Server) IsShuttingDown() bool {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	return s.shuttingDown
+}
+
+// acceptConnection registers a socket unless the server is shutting down.
+// Both happen under the lifecycle lock so Shutdown never misses a socket.
+func (s *Server) acceptConnection(socket *Socket) bool {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	if s.shuttingDown {
+		return false
+	}
+
+	s.connections.begin()
+	s.addSocket(socket)
+	return true
+}
+
+// beginHandler counts the handler of a message read by socket. Once the
+// server is shutting down, messages are dropped so Shutdown can wait for the
+// running handlers, except on sockets with a request waiting for its reply.
+func (s *Server) beginHandler(socket *Socket) bool {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	if s.shuttingDown && !socket.awaitingReply() {
+		return false
+	}
+
+	s.handlers.begin()
+	return true
+}
+
+// refuse answers a message dropped while the server drains. Requests get a
+// retryable CodeUnavailable error encoded with the socket's codec; other
+// messages, and messages of sockets without a codec, are dropped silently.
+func (s *Socket) refuse(msg *SocketMessage) {
+	codec := s.Codec()
+	if codec == nil {
+		return
+	}
+
+	envelope, err := codec.Decode(msg.RawData)
+	if err != nil || envelope.ID == "" {
+		return
+	}
+
+	data, err := codec.Encode(&OutboundMessage{
+		ID:    envelope.ID,
+		Error: &Error{Code: CodeUnavailable, Message: "server shutting down", Retryable: true},
+	})
+	if err != nil {
+		s.server.logger.WithError(err).Error("failed to encode unavailable error")
+		return
+	}
+
+	if err := s.Send(codec.MessageType(), data); err != nil && !errors.Is(err, ErrSocketClosed) {
+		s.server.logger.WithError(err).Error("failed to write unavailable error")
+	}
+}
+
+// activity counts running operations and lets callers wait until none are left
+type activity struct {
+	mu    sync.Mutex
+	count int
+	idle  chan struct{}
+}
+
+func (a *activity) begin() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.count++
+}
+
+func (a *activity) end() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.count--
+	if a.count == 0 && a.idle != nil {
+		close(a.idle)
+		a.idle = nil
+	}
+}
+
+func (a *activity) wait(ctx context.Context) error {
+	a.mu.Lock()
+	if a.count == 0 {
+		a.mu.Unlock()
+		return nil
+	}
+
+	if a.idle == nil {
+		a.idle = make(chan struct{})
+	}
+
+	idle := a.idle
+	a.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
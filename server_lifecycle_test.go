@@ -0,0 +1,155 @@
+package websocket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/json"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+func newJSONServer(t *testing.T, opts ...ws.ServerOption) *ws.Server {
+	t.Helper()
+	server := ws.NewServer(append([]ws.ServerOption{ws.WithCodec(json.Codec())}, opts...)...)
+	if err := server.Use(json.Middleware()); err != nil {
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+func on(t *testing.T, server *ws.Server, event string, handler func(ctx *ws.Context)) {
+	t.Helper()
+	if err := server.On(event, handler); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func shutdown(server *ws.Server) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		done <- server.Shutdown(ctx)
+	}()
+
+	return done
+}
+
+func waitShuttingDown(t *testing.T, server *ws.Server) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !server.IsShuttingDown() {
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start shutting down")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestShutdownDropsMessagesWhileDraining(t *testing.T) {
+	server := newJSONServer(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	late := make(chan struct{}, 1)
+	on(t, server, "slow", func(ctx *ws.Context) {
+		close(started)
+		<-release
+	})
+
+	on(t, server, "late", func(ctx *ws.Context) {
+		late <- struct{}{}
+	})
+
+	client := wstest.NewClient(t, server)
+	client.Emit("slow", nil)
+	<-started
+
+	done := shutdown(server)
+	waitShuttingDown(t, server)
+	client.Emit("late", nil)
+
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v before the running handler finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	client.ExpectClosed(ws.StatusGoingAway)
+	select {
+	case <-late:
+		t.Fatal("message read while draining was handled")
+	default:
+	}
+}
+
+func TestShutdownDeliversRepliesToRunningRequests(t *testing.T) {
+	server := newJSONServer(t)
+	replies := make(chan string, 1)
+	on(t, server, "ask", func(ctx *ws.Context) {
+		var reply string
+		if err := ctx.RequestIntoWithTimeout("ping", &reply, time.Second); err != nil {
+			t.Errorf("Request: %v", err)
+		}
+
+		replies <- reply
+	})
+
+	client := wstest.NewClient(t, server)
+	client.Emit("ask", nil)
+	request := client.Receive()
+
+	done := shutdown(server)
+	waitShuttingDown(t, server)
+	client.Reply(request, "pong")
+
+	if reply := <-replies; reply != "pong" {
+		t.Fatalf("reply = %q, want pong", reply)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	client.ExpectClosed(ws.StatusGoingAway)
+}
+
+func TestShutdownRefusesRequestsWhileDraining(t *testing.T) {
+	server := newJSONServer(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	on(t, server, "slow", func(ctx *ws.Context) {
+		close(started)
+		<-release
+	})
+
+	on(t, server, "late", func(ctx *ws.Context) {
+		ctx.Reply("handled")
+	})
+
+	client := wstest.NewClient(t, server)
+	client.Emit("slow", nil)
+	<-started
+
+	done := shutdown(server)
+	waitShuttingDown(t, server)
+	reply := client.Request("late", nil)
+	if reply.Error == nil || reply.Error.Code != ws.CodeUnavailable || !reply.Error.Retryable {
+		t.Fatalf("reply error = %+v, want a retryable %s error", reply.Error, ws.CodeUnavailable)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	client.ExpectClosed(ws.StatusGoingAway)
+}
@@ -0,0 +1,357 @@
+package websocket
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SessionTokenHeader carries the session token in the upgrade response
+	SessionTokenHeader = "X-Session-Token"
+	// SessionResumedHeader tells the client whether its session was resumed
+	SessionResumedHeader = "X-Session-Resumed"
+	// ResumeTokenParam and ResumeSeqParam are the query parameters a
+	// reconnecting client sends: its session token and the number of
+	// messages it received so far.
+	ResumeTokenParam = "session"
+	ResumeSeqParam   = "last"
+
+	DefaultResumeHistory = 256
+)
+
+// SetResumption lets clients that lose their connection resume their session
+// within grace. Every socket gets a session token, sent to the client in the
+// SessionTokenHeader of the upgrade response, and remembers the last history
+// messages it sent. A socket whose connection drops without a close frame
+// stays in the server's registry and its rooms for the grace period, and
+// messages sent to it are kept for the client. A client reconnecting with
+// its token and the number of messages it received gets a socket with the
+// same ID, values and rooms, followed by the messages it missed. A zero
+// grace disables resumption.
+func (s *Server) SetResumption(grace time.Duration, history int) {
+	if grace <= 0 {
+		s.sessions = nil
+		return
+	}
+
+	if history <= 0 {
+		history = DefaultResumeHistory
+	}
+
+	s.sessions = &sessionManager{
+		sessions: map[string]*session{},
+		grace:    grace,
+		history:  history,
+	}
+}
+
+func WithResumption(grace time.Duration, history int) ServerOption {
+	return func(s *Server) {
+		s.SetResumption(grace, history)
+	}
+}
+
+// Resumed reports whether the socket took over the session of a dropped one
+func (s *Socket) Resumed() bool {
+	return s.resumed
+}
+
+type sessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	grace    time.Duration
+	history  int
+}
+
+type session struct {
+	token    string
+	mu       sync.Mutex
+	socket   *Socket
+	seq      uint64
+	history  []sessionEntry
+	limit    int
+	detached bool
+	claimed  bool
+	ended    bool
+	timer    *time.Timer
+}
+
+type sessionEntry struct {
+	seq uint64
+	msg *SocketMessage
+}
+
+// resumption is the session a new connection is about to use
+type resumption struct {
+	session *session
+	resumed bool
+	last    uint64
+}
+
+// prepare picks the session for an upgrade request: the detached session
+// named by the request if it can be resumed, or a new one.
+func (m *sessionManager) prepare(req *http.Request) *resumption {
+	query := req.URL.Query()
+	if token := query.Get(ResumeTokenParam); token != "" {
+		last, err := strconv.ParseUint(query.Get(ResumeSeqParam), 10, 64)
+		m.mu.Lock()
+		sess := m.sessions[token]
+		m.mu.Unlock()
+		if err == nil && sess != nil && sess.claim(last) {
+			return &resumption{session: sess, resumed: true, last: last}
+		}
+	}
+
+	sess := &session{token: uuid.NewString(), limit: m.history}
+	m.mu.Lock()
+	m.sessions[sess.token] = sess
+	m.mu.Unlock()
+	return &resumption{session: sess}
+}
+
+func (m *sessionManager) remove(sess *session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, sess.token)
+}
+
+func (m *sessionManager) all() []*session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sessions []*session
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+
+	return sessions
+}
+
+// claim reserves a detached session for a reconnecting client that received
+// last messages. It fails if the history no longer holds every message
+// after last.
+func (sess *session) claim(last uint64) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if !sess.detached || sess.claimed || sess.ended || last > sess.seq {
+		return false
+	}
+
+	if last < sess.seq && (len(sess.history) == 0 || sess.history[0].seq > last+1) {
+		return false
+	}
+
+	sess.claimed = true
+	sess.timer.Stop()
+	return true
+}
+
+// owner returns the socket currently holding the session
+func (sess *session) owner() *Socket {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.socket
+}
+
+// record assigns the next sequence number to a message about to be written
+// and keeps it in the history. The caller must hold the lock.
+func (sess *session) record(msg *SocketMessage) {
+	sess.seq++
+	sess.history = append(sess.history, sessionEntry{seq: sess.seq, msg: msg})
+	if len(sess.history) > sess.limit {
+		sess.history[0] = sessionEntry{}
+		sess.history = sess.history[1:]
+	}
+}
+
+func (sess *session) recordAll(msgs ...*SocketMessage) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	for _, msg := range msgs {
+		sess.record(msg)
+	}
+}
+
+// write records and writes a message for a socket without an outbound
+// queue. Holding the lock keeps sequence numbers in write order.
+func (sess *session) write(socket *Socket, msg *SocketMessage) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.record(msg)
+	if sess.detached || socket.wasDropped() {
+		return nil
+	}
+
+	return socket.connection.Write(socket.ctx, msg)
+}
+
+// keep records a message sent to a dropped socket so it can be replayed
+func (sess *session) keep(msg *SocketMessage) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.ended {
+		return ErrSocketClosed
+	}
+
+	sess.record(msg)
+	return nil
+}
+
+// since returns the messages after last. The caller must hold the lock.
+func (sess *session) since(last uint64) []*SocketMessage {
+	var msgs []*SocketMessage
+	for _, entry := range sess.history {
+		if entry.seq > last {
+			msgs = append(msgs, entry.msg)
+		}
+	}
+
+	return msgs
+}
+
+// adopt gives a new socket the identity of the session's dropped socket
+func (s *Socket) adopt(resume *resumption) {
+	s.session = resume.session
+	if !resume.resumed {
+		resume.session.socket = s
+		return
+	}
+
+	previous := resume.session.owner()
+	s.id = previous.id
+	s.resumed = true
+	previous.associatedValuesMx.Lock()
+	defer previous.associatedValuesMx.Unlock()
+	for key, value := range previous.associatedValues {
+		if _, ok := s.associatedValues[key]; !ok {
+			s.associatedValues[key] = value
+		}
+	}
+}
+
+// resumeSession moves the rooms of the dropped socket to the new one and
+// hands it the session. Messages the client missed are written before
+// anything sent afterwards.
+func (s *Server) resumeSession(socket *Socket, resume *resumption) {
+	sess := resume.session
+	previous := sess.owner()
+	previous.roomsMx.Lock()
+	rooms := previous.rooms
+	previous.rooms = map[string]*Room{}
+	previous.roomsMx.Unlock()
+	socket.roomsMx.Lock()
+	for name, room := range rooms {
+		socket.rooms[name] = room
+		room.replaceSocket(previous, socket)
+	}
+	socket.roomsMx.Unlock()
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.socket = socket
+	sess.detached = false
+	sess.claimed = false
+	missed := sess.since(resume.last)
+	if socket.outbound != nil {
+		socket.runWriter(missed)
+	} else {
+		for _, msg := range missed {
+			if err := socket.connection.Write(socket.ctx, msg); err != nil {
+				break
+			}
+		}
+	}
+
+	s.connections.end()
+}
+
+// abandonSession releases a session whose new connection failed before it
+// was served
+func (s *Server) abandonSession(resume *resumption) {
+	sess := resume.session
+	if !resume.resumed {
+		s.sessions.remove(sess)
+		return
+	}
+
+	sess.mu.Lock()
+	sess.claimed = false
+	sess.timer = time.AfterFunc(s.sessions.grace, func() {
+		s.expireSession(sess)
+	})
+	sess.mu.Unlock()
+	if s.IsShuttingDown() {
+		s.expireSession(sess)
+	}
+}
+
+// detachSession keeps a dropped socket around for its client to resume. It
+// returns false if the socket's session ends instead.
+func (s *Server) detachSession(socket *Socket) bool {
+	sess := socket.session
+	if sess == nil {
+		return false
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.socket != socket {
+		return false
+	}
+
+	if s.shuttingDown || !socket.wasDropped() || sess.ended {
+		sess.ended = true
+		s.sessions.remove(sess)
+		return false
+	}
+
+	sess.detached = true
+	sess.timer = time.AfterFunc(s.sessions.grace, func() {
+		s.expireSession(sess)
+	})
+
+	s.connections.begin()
+	return true
+}
+
+// expireSession ends a detached session and finishes closing its socket
+func (s *Server) expireSession(sess *session) {
+	sess.mu.Lock()
+	if !sess.detached || sess.claimed || sess.ended {
+		sess.mu.Unlock()
+		return
+	}
+
+	sess.ended = true
+	sess.timer.Stop()
+	socket := sess.socket
+	sess.mu.Unlock()
+
+	s.sessions.remove(sess)
+	defer s.connections.end()
+	s.finishSocket(socket)
+}
+
+// expireSessions ends every detached session, during shutdown
+func (s *Server) expireSessions() {
+	if s.sessions == nil {
+		return
+	}
+
+	for _, sess := range s.sessions.all() {
+		s.expireSession(sess)
+	}
+}
+
+func (r *Room) replaceSocket(previous *Socket, socket *Socket) {
+	r.mu.Lock()
+	delete(r.sockets, previous)
+	r.sockets[socket] = true
+	r.mu.Unlock()
+	r.replacePresence(previous, socket)
+}
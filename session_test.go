@@ -0,0 +1,137 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	ws "github.com/snapflowio/websocket"
+)
+
+type sessionClient struct {
+	conn    *websocket.Conn
+	token   string
+	resumed bool
+}
+
+func dialSession(t *testing.T, endpoint string, query url.Values) *sessionClient {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if query != nil {
+		endpoint += "?" + query.Encode()
+	}
+
+	conn, res, err := websocket.Dial(ctx, endpoint, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.CloseNow()
+	})
+
+	return &sessionClient{
+		conn:    conn,
+		token:   res.Header.Get(ws.SessionTokenHeader),
+		resumed: res.Header.Get(ws.SessionResumedHeader) == "true",
+	}
+}
+
+func (c *sessionClient) event(t *testing.T) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, data, err := c.conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	var msg struct {
+		Event string `json:"event"`
+	}
+
+	if err := json.Unmarshal(data, &msg); err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+
+	return msg.Event
+}
+
+func TestResumptionReplaysMissedMessages(t *testing.T) {
+	server := newJSONServer(t, ws.WithResumption(time.Minute, 16))
+	ids := make(chan string, 2)
+	if err := server.UseOpen(func(ctx *ws.Context) {
+		if !ctx.Resumed() {
+			ctx.Join("lobby")
+		}
+
+		ids <- ctx.SocketID()
+		server.EmitToSocket(ctx.SocketID(), "welcome", nil)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	endpoint := "ws" + strings.TrimPrefix(httpServer.URL, "http")
+
+	first := dialSession(t, endpoint, nil)
+	id := <-ids
+	if first.token == "" {
+		t.Fatal("no session token in the upgrade response")
+	}
+
+	if event := first.event(t); event != "welcome" {
+		t.Fatalf("got %q, want welcome", event)
+	}
+
+	socket := server.Socket(id)
+	first.conn.CloseNow()
+	<-socket.Done()
+	server.To("lobby").Emit("missed", nil)
+
+	query := url.Values{
+		ws.ResumeTokenParam: {first.token},
+		ws.ResumeSeqParam:   {strconv.Itoa(1)},
+	}
+
+	// The server may still be detaching the dropped socket
+	var second *sessionClient
+	deadline := time.Now().Add(2 * time.Second)
+	for second == nil || !second.resumed {
+		if time.Now().After(deadline) {
+			t.Fatal("session was not resumed")
+		}
+
+		if second != nil {
+			<-ids
+			second.conn.CloseNow()
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		second = dialSession(t, endpoint, query)
+	}
+
+	if resumedID := <-ids; resumedID != id {
+		t.Fatalf("resumed socket has ID %s, want %s", resumedID, id)
+	}
+
+	if event := second.event(t); event != "missed" {
+		t.Fatalf("got %q, want the missed message first", event)
+	}
+
+	if event := second.event(t); event != "welcome" {
+		t.Fatalf("got %q, want welcome", event)
+	}
+
+	if lobby := server.Rooms().GetRoom("lobby"); !lobby.Has(server.Socket(id)) {
+		t.Fatal("resumed socket is not in the rooms of the dropped one")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/coder/websocket"
@@ -23,11 +24,22 @@ type Socket struct {
 	roomsMx            sync.RWMutex
 	rooms              map[string]*Room
 	roomManager        *RoomManager
+	server             *Server
+	slots              chan struct{}
+	codec              atomic.Pointer[Codec]
+	outbound           *outboundQueue
+	writeCtx           context.Context
+	cancelWrite        context.CancelFunc
+	lastRead           atomic.Int64
+	latency            atomic.Int64
 	closeMu            sync.Mutex
 	closed             bool
 	closeStatus        Status
 	closeStatusSource  CloseSource
 	closeReason        string
+	dropped            bool
+	session            *session
+	resumed            bool
 	ctx                context.Context
 	cancelCtx          context.CancelFunc
 }
@@ -45,6 +57,7 @@ func NewSocket(info *ConnectionInfo, conn SocketConnection) *Socket {
 	}
 
 	s.ctx, s.cancelCtx = context.WithCancel(context.Background())
+	s.touch()
 
 	return s
 }
@@ -83,6 +96,15 @@ func (s *Socket) QueryParams() map[string]string {
 	return make(map[string]string)
 }
 
+// Subprotocol returns the subprotocol negotiated with the client, if any
+func (s *Socket) Subprotocol() string {
+	if s.connectionInfo != nil {
+		return s.connectionInfo.Subprotocol
+	}
+
+	return ""
+}
+
 func (s *Socket) RemoteAddr() string {
 	if s.connectionInfo != nil {
 		return s.connectionInfo.RemoteAddr
@@ -92,17 +114,54 @@ func (s *Socket) RemoteAddr() string {
 }
 
 func (s *Socket) Close(status Status, reason string, source CloseSource) {
+	if !s.markClosed(status, reason, source, false) {
+		return
+	}
+
+	// Closing the connection sends the close frame to the client and unblocks
+	// the pending read once the client answers. Queued messages are written
+	// first. Client initiated closes have already completed the handshake.
+	s.stopWriter(source == ServerCloseSource)
+	if source == ServerCloseSource {
+		_ = s.connection.Close(status, reason)
+	}
+
+	s.cancelCtx()
+}
+
+// terminate closes a socket whose connection failed or whose client stopped
+// responding. The connection is dropped without waiting for a close
+// handshake that would never finish.
+func (s *Socket) terminate(status Status, reason string) {
+	if !s.markClosed(status, reason, ServerCloseSource, true) {
+		return
+	}
+
+	s.stopWriter(false)
+	s.cancelCtx()
+	_ = s.connection.Close(status, reason)
+}
+
+// wasDropped reports whether the socket was closed by terminate
+func (s *Socket) wasDropped() bool {
+	s.closeMu.Lock()
+	defer s.closeMu.Unlock()
+	return s.dropped
+}
+
+func (s *Socket) markClosed(status Status, reason string, source CloseSource, dropped bool) bool {
 	s.closeMu.Lock()
 	defer s.closeMu.Unlock()
 	if s.closed {
-		return
+		return false
 	}
 
 	s.closed = true
 	s.closeStatus = status
 	s.closeReason = reason
 	s.closeStatusSource = source
-	s.cancelCtx()
+	s.dropped = dropped
+	return true
 }
 
 func (s *Socket) IsClosed() bool {
@@ -112,10 +171,56 @@ func (s *Socket) IsClosed() bool {
 }
 
 func (s *Socket) Send(messageType MessageType, data []byte) error {
-	return s.connection.Write(s.ctx, &SocketMessage{
+	msg := &SocketMessage{
 		Type: messageType,
 		Data: data,
-	})
+	}
+
+	if s.session != nil {
+		// A socket that was resumed by another connection forwards to it
+		if owner := s.session.owner(); owner != s {
+			return owner.Send(messageType, data)
+		}
+	}
+
+	if s.outbound == nil {
+		if s.session != nil {
+			return s.session.write(s, msg)
+		}
+
+		return s.connection.Write(s.ctx, msg)
+	}
+
+	overflowed, err := s.outbound.push(msg)
+	if overflowed {
+		go s.Close(StatusPolicyViolation, "outbound queue full", ServerCloseSource)
+	}
+
+	if err != nil && s.session != nil && s.keepsUnsent(err) {
+		return s.session.keep(msg)
+	}
+
+	return err
+}
+
+// keepsUnsent reports whether a message that could not be queued should be
+// kept in the session history: the connection failed or was dropped, so the
+// client may resume.
+func (s *Socket) keepsUnsent(err error) bool {
+	if errors.Is(err, ErrOutboundQueueFull) {
+		return false
+	}
+
+	if errors.Is(err, ErrSocketClosed) {
+		if !s.wasDropped() {
+			return false
+		}
+
+		// Let the writer record what was still queued first
+		<-s.outbound.done
+	}
+
+	return true
 }
 
 func (s *Socket) Set(key string, value any) {
@@ -149,8 +254,24 @@ func (s *Socket) Delete(key string) {
 }
 
 func (s *Socket) HandleNextMessageWithNode(node *HandlerNode) bool {
+	return s.handleNextMessage(func(message *InboundMessage, messageType MessageType) *Context {
+		return NewContextWithNodeAndMessageType(s, message, node, messageType)
+	})
+}
+
+func (s *Socket) HandleNextMessageWithRouter(router *Router) bool {
+	return s.handleNextMessage(func(message *InboundMessage, messageType MessageType) *Context {
+		return NewContextWithRouter(s, message, router, messageType)
+	})
+}
+
+func (s *Socket) handleNextMessage(newContext func(message *InboundMessage, messageType MessageType) *Context) bool {
 	msg, err := s.connection.Read(s)
 	if err != nil {
+		if s.IsClosed() {
+			return false
+		}
+
 		closeStatus := websocket.CloseStatus(err)
 		if closeStatus != -1 {
 			s.Close(Status(closeStatus), "", ClientCloseSource)
@@ -159,16 +280,53 @@ func (s *Socket) HandleNextMessageWithNode(node *HandlerNode) bool {
 		if errors.Is(err, context.Canceled) {
 			return false
 		}
-		panic(fmt.Errorf("error reading socket message: %w", err))
+		if errors.Is(err, websocket.ErrMessageTooBig) {
+			s.Close(StatusMessageTooBig, "message too big", ServerCloseSource)
+			return false
+		}
+
+		// The connection broke without a close frame, e.g. a failed write or
+		// a reset by the peer.
+		s.terminate(StatusAbnormalClosure, "connection lost")
+		return false
+	}
+
+	s.touch()
+
+	if s.server != nil && !s.server.beginHandler(s) {
+		s.refuse(msg)
+		return true
+	}
+
+	if !s.acquireSlot() {
+		if s.server != nil {
+			s.server.handlers.end()
+		}
+
+		return true
 	}
 
+	slot := newProcessingSlot(s)
 	go func() {
+		if slot != nil {
+			defer slot.release()
+		}
+
+		if s.server != nil {
+			defer s.server.handlers.end()
+		}
+
 		inboundMsg := inboundMessageFromPool()
 		inboundMsg.RawData = msg.RawData
 		inboundMsg.Data = msg.Data
 		inboundMsg.Meta = msg.Meta
-		ctx := NewContextWithNodeAndMessageType(s, inboundMsg, node, msg.Type)
+		ctx := newContext(inboundMsg, msg.Type)
+		ctx.slot = slot
 		ctx.Next()
+		if s.server != nil {
+			s.server.handleError(ctx)
+		}
+
 		ctx.free()
 	}()
 
@@ -194,6 +352,14 @@ func (s *Socket) GetInterceptor(id string) (chan *InboundMessage, bool) {
 	return interceptorChan, ok
 }
 
+// awaitingReply reports whether a request sent to the socket waits for its
+// reply
+func (s *Socket) awaitingReply() bool {
+	s.interceptorsMx.Lock()
+	defer s.interceptorsMx.Unlock()
+	return len(s.interceptors) > 0
+}
+
 func (s *Socket) AddInterceptor(id string, interceptorChan chan *InboundMessage) {
 	s.interceptorsMx.Lock()
 	defer s.interceptorsMx.Unlock()
@@ -231,11 +397,7 @@ func (s *Socket) Join(roomName string) {
 		return
 	}
 
-	s.roomsMx.Lock()
-	defer s.roomsMx.Unlock()
-	room := s.roomManager.Room(roomName)
-	s.rooms[roomName] = room
-	room.addSocket(s)
+	s.roomManager.join(roomName, s)
 }
 
 func (s *Socket) Leave(roomName string) {
@@ -0,0 +1,120 @@
+package socketio
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	websocket "github.com/snapflowio/websocket"
+)
+
+const Subprotocol = "socket.io"
+
+// codec encodes messages as Socket.IO packets. Replies to a message sent
+// with an ack become ack packets and everything else an event; messages
+// without an event are emitted as "message". The codec of a connection also
+// sends Context.Request messages with an ack id of its own.
+type codec struct {
+	adapter *Adapter
+	session *session
+}
+
+func (c *codec) Name() string {
+	return Subprotocol
+}
+
+// Decode reads event and ack packets. Other packets need the Adapter.
+func (c *codec) Decode(raw []byte) (*websocket.Envelope, error) {
+	s := string(raw)
+	if !strings.HasPrefix(s, string(engineMessage)) {
+		return nil, errInvalidPacket
+	}
+
+	p, err := parsePacket(s[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if p.kind != packetEvent && p.kind != packetAck {
+		return nil, errInvalidPacket
+	}
+
+	var args []json.RawMessage
+	if err := json.Unmarshal(p.payload, &args); err != nil {
+		return nil, err
+	}
+
+	envelope := &websocket.Envelope{Meta: map[string]any{"namespace": p.namespace}}
+	if p.kind == packetEvent {
+		var event string
+		if len(args) == 0 || json.Unmarshal(args[0], &event) != nil {
+			return nil, fmt.Errorf("event without name")
+		}
+
+		envelope.Event = c.adapter.namespaces[p.namespace] + event
+		args = args[1:]
+	}
+
+	if p.ack != "" {
+		envelope.ID = c.inboundID(p)
+	}
+
+	envelope.Data = argsData(args)
+	return envelope, nil
+}
+
+func (c *codec) Unmarshal(message *websocket.InboundMessage, into any) error {
+	return json.Unmarshal(message.Data, into)
+}
+
+func (c *codec) Encode(message *websocket.OutboundMessage) ([]byte, error) {
+	if message.ID != "" && message.Event == "" {
+		if namespace, ack, ok := parseMessageID(message.ID); ok {
+			args := toArgs(message.Data)
+			if message.Error != nil {
+				args = []any{map[string]any{"error": message.Error}}
+			}
+
+			payload, err := json.Marshal(args)
+			if err != nil {
+				return nil, err
+			}
+
+			return (&packet{kind: packetAck, namespace: namespace, ack: ack, payload: payload}).encode(), nil
+		}
+	}
+
+	event := message.Event
+	if event == "" {
+		event = "message"
+	}
+
+	namespace, name := c.adapter.split(event)
+	payload, err := json.Marshal(append([]any{name}, toArgs(message.Data)...))
+	if err != nil {
+		return nil, err
+	}
+
+	var ack string
+	if message.ID != "" && c.session != nil {
+		ack = c.session.request(namespace, message.ID)
+	}
+
+	return (&packet{kind: packetEvent, namespace: namespace, ack: ack, payload: payload}).encode(), nil
+}
+
+// inboundID is the message ID of a packet with an ack id. Acks answering a
+// request of the server get the ID of the request.
+func (c *codec) inboundID(p *packet) string {
+	if p.kind == packetAck && c.session != nil {
+		if id, ok := c.session.reply(p.namespace, p.ack); ok {
+			return id
+		}
+	}
+
+	return messageID(p.namespace, p.ack)
+}
+
+func (c *codec) MessageType() websocket.MessageType {
+	return websocket.MessageText
+}
@@ -0,0 +1,124 @@
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Engine.IO v4 packet types
+const (
+	engineOpen    = '0'
+	engineClose   = '1'
+	enginePing    = '2'
+	enginePong    = '3'
+	engineMessage = '4'
+	engineUpgrade = '5'
+	engineNoop    = '6'
+)
+
+// Socket.IO v5 packet types
+const (
+	packetConnect      = '0'
+	packetDisconnect   = '1'
+	packetEvent        = '2'
+	packetAck          = '3'
+	packetConnectError = '4'
+	packetBinaryEvent  = '5'
+	packetBinaryAck    = '6'
+)
+
+var errInvalidPacket = errors.New("invalid socket.io packet")
+
+// packet is a Socket.IO packet carried by an Engine.IO message packet
+type packet struct {
+	kind      byte
+	namespace string
+	ack       string
+	payload   json.RawMessage
+}
+
+// parsePacket reads <type>[<attachments>-][<namespace>,][<ack id>][<payload>]
+func parsePacket(s string) (*packet, error) {
+	if s == "" || s[0] < packetConnect || s[0] > packetBinaryAck {
+		return nil, errInvalidPacket
+	}
+
+	p := &packet{kind: s[0], namespace: "/"}
+	s = s[1:]
+	if p.kind == packetBinaryEvent || p.kind == packetBinaryAck {
+		i := strings.IndexByte(s, '-')
+		if i < 0 {
+			return nil, errInvalidPacket
+		}
+
+		s = s[i+1:]
+	}
+
+	if strings.HasPrefix(s, "/") {
+		i := strings.IndexByte(s, ',')
+		if i < 0 {
+			p.namespace, s = s, ""
+		} else {
+			p.namespace, s = s[:i], s[i+1:]
+		}
+	}
+
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	p.ack, s = s[:i], s[i:]
+	if s != "" {
+		if !json.Valid([]byte(s)) {
+			return nil, errInvalidPacket
+		}
+
+		p.payload = json.RawMessage(s)
+	}
+
+	return p, nil
+}
+
+// encode returns the Engine.IO message packet holding p
+func (p *packet) encode() []byte {
+	var b strings.Builder
+	b.WriteByte(engineMessage)
+	b.WriteByte(p.kind)
+	if p.namespace != "" && p.namespace != "/" {
+		b.WriteString(p.namespace)
+		b.WriteByte(',')
+	}
+
+	b.WriteString(p.ack)
+	b.Write(p.payload)
+	return []byte(b.String())
+}
+
+// messageID is the message ID of an ack id, which keeps the namespace so
+// the reply can be sent back to it
+func messageID(namespace, ack string) string {
+	if namespace == "/" {
+		return ack
+	}
+
+	return namespace + "," + ack
+}
+
+// parseMessageID splits a message ID made by messageID. It fails for IDs
+// that are not acks, like the ones of Context.Request, which the codec of a
+// connection sends with an ack id of its own.
+func parseMessageID(id string) (string, string, bool) {
+	namespace, ack := "/", id
+	if i := strings.LastIndexByte(id, ','); i >= 0 && strings.HasPrefix(id, "/") {
+		namespace, ack = id[:i], id[i+1:]
+	}
+
+	if _, err := strconv.ParseUint(ack, 10, 64); err != nil {
+		return "", "", false
+	}
+
+	return namespace, ack, true
+}
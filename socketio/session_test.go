@@ -0,0 +1,42 @@
+package socketio
+
+import (
+	"testing"
+
+	websocket "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+func TestSessionForgetsRequestsThatStoppedWaiting(t *testing.T) {
+	conn, _ := wstest.Pipe()
+	socket := websocket.NewSocket(&websocket.ConnectionInfo{}, conn)
+	sess := newSession(New(), socket)
+	if ack := sess.request("/", "event"); ack != "" {
+		t.Fatalf("message without interceptor got ack %s", ack)
+	}
+
+	replies := make(chan *websocket.InboundMessage, 1)
+	socket.AddInterceptor("answered", replies)
+	socket.AddInterceptor("timed out", replies)
+	answered := sess.request("/", "answered")
+	timedOut := sess.request("/", "timed out")
+
+	// The request gives up, removing its interceptor
+	socket.RemoveInterceptor("timed out")
+	sess.prune()
+	if len(sess.requests) != 1 {
+		t.Fatalf("%d requests kept, want 1", len(sess.requests))
+	}
+
+	if _, ok := sess.reply("/", timedOut); ok {
+		t.Fatal("late ack matched a request that timed out")
+	}
+
+	if id, ok := sess.reply("/", answered); !ok || id != "answered" {
+		t.Fatalf("ack matched %q, %v, want answered", id, ok)
+	}
+
+	if len(sess.requests) != 0 {
+		t.Fatalf("%d requests kept after the reply", len(sess.requests))
+	}
+}
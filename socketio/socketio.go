@@ -0,0 +1,460 @@
+// Package socketio lets socket.io-client connect to a Server. It speaks the
+// Engine.IO v4 and Socket.IO v5 packet framing over the WebSocket transport:
+//
+//   - emit(event, ...args, ack) runs the handlers of the event with the
+//     arguments as data, and the ack receives Context.Reply
+//   - namespaces other than "/" prefix their events, so "chat" in the
+//     "/admin" namespace is the event "admin.chat"
+//   - rooms are the server's rooms
+//   - Context.Request emits "message" with an ack, answered by the client's
+//     ack callback
+//
+// HTTP long-polling and binary attachments are not supported, so clients
+// must use the websocket transport.
+package socketio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	websocket "github.com/snapflowio/websocket"
+)
+
+const (
+	DefaultPingInterval = 25 * time.Second
+	DefaultPingTimeout  = 20 * time.Second
+	// DefaultMaxPayload matches the server's default read limit
+	DefaultMaxPayload = 32768
+
+	sessionKey = "socketio.session"
+)
+
+var ErrBinaryNotSupported = errors.New("socket.io binary packets are not supported")
+
+// Args are the arguments of an emit. Data of this type is sent as several
+// arguments instead of one.
+type Args []any
+
+// Authorizer decides whether a client may connect to a namespace. auth is
+// the auth payload given to the client. A returned error is sent to the
+// client as a connect error.
+type Authorizer func(ctx *websocket.Context, namespace string, auth json.RawMessage) error
+
+type Option func(a *Adapter)
+
+// WithNamespaces declares the namespaces clients may connect to besides "/"
+func WithNamespaces(namespaces ...string) Option {
+	return func(a *Adapter) {
+		for _, namespace := range namespaces {
+			if !strings.HasPrefix(namespace, "/") {
+				namespace = "/" + namespace
+			}
+
+			a.namespaces[namespace] = strings.TrimPrefix(namespace, "/") + "."
+		}
+	}
+}
+
+// WithPing sets how often the server pings clients and how long it waits
+// for the pong before closing the connection
+func WithPing(interval, timeout time.Duration) Option {
+	return func(a *Adapter) {
+		a.pingInterval = interval
+		a.pingTimeout = timeout
+	}
+}
+
+// WithMaxPayload sets the message size announced to clients. It should
+// match the server's read limit.
+func WithMaxPayload(maxPayload int64) Option {
+	return func(a *Adapter) {
+		a.maxPayload = maxPayload
+	}
+}
+
+func WithAuthorizer(authorizer Authorizer) Option {
+	return func(a *Adapter) {
+		a.authorizer = authorizer
+	}
+}
+
+// WithLogger sets the logger reporting packets that could not be sent
+func WithLogger(logger *logrus.Logger) Option {
+	return func(a *Adapter) {
+		a.logger = logger
+	}
+}
+
+// Adapter is a middleware that handles the sockets of socket.io clients and
+// passes the messages of other sockets on untouched. Register it before any
+// other codec middleware:
+//
+//	server.Use(socketio.New(socketio.WithNamespaces("/admin")))
+//	server.Use(json.Middleware())
+//	http.Handle("/socket.io/", server)
+type Adapter struct {
+	namespaces   map[string]string
+	prefixes     []string
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	maxPayload   int64
+	authorizer   Authorizer
+	logger       *logrus.Logger
+	codec        *codec
+}
+
+var _ websocket.Handler = &Adapter{}
+var _ websocket.OpenHandler = &Adapter{}
+
+func New(opts ...Option) *Adapter {
+	a := &Adapter{
+		namespaces:   map[string]string{"/": ""},
+		pingInterval: DefaultPingInterval,
+		pingTimeout:  DefaultPingTimeout,
+		maxPayload:   DefaultMaxPayload,
+		logger:       logrus.New(),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	for namespace := range a.namespaces {
+		if namespace != "/" {
+			a.prefixes = append(a.prefixes, namespace)
+		}
+	}
+
+	// Longest prefixes first, so nested namespaces win
+	sort.Slice(a.prefixes, func(i, j int) bool {
+		return len(a.prefixes[i]) > len(a.prefixes[j])
+	})
+
+	a.codec = &codec{adapter: a}
+	return a
+}
+
+// Codec returns the codec encoding messages as Socket.IO packets
+func (a *Adapter) Codec() websocket.Codec {
+	return a.codec
+}
+
+type session struct {
+	mu         sync.Mutex
+	socket     *websocket.Socket
+	codec      *codec
+	namespaces map[string]bool
+	pong       chan struct{}
+	requests   map[string]string
+	nextAck    uint64
+}
+
+func newSession(a *Adapter, socket *websocket.Socket) *session {
+	sess := &session{
+		socket:     socket,
+		namespaces: map[string]bool{},
+		pong:       make(chan struct{}, 1),
+		requests:   map[string]string{},
+	}
+
+	sess.codec = &codec{adapter: a, session: sess}
+	return sess
+}
+
+func (s *session) connected(namespace string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.namespaces[namespace]
+}
+
+func (s *session) setConnected(namespace string, connected bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if connected {
+		s.namespaces[namespace] = true
+	} else {
+		delete(s.namespaces, namespace)
+	}
+}
+
+// request returns the ack id a message is sent with, if it is a request of
+// the server waiting for its reply. Socket.IO ack ids are numbers, so the ID
+// of the request is kept until the client acks it or the request stops
+// waiting.
+func (s *session) request(namespace, id string) string {
+	if _, ok := s.socket.GetInterceptor(id); !ok {
+		return ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+	ack := strconv.FormatUint(s.nextAck, 10)
+	s.nextAck++
+	s.requests[messageID(namespace, ack)] = id
+	return ack
+}
+
+// reply returns the ID of the request a client ack answers
+func (s *session) reply(namespace, ack string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := messageID(namespace, ack)
+	id, ok := s.requests[key]
+	delete(s.requests, key)
+	return id, ok
+}
+
+// prune forgets the requests that timed out or were cancelled before the
+// client acked them
+func (s *session) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked()
+}
+
+func (s *session) pruneLocked() {
+	for key, id := range s.requests {
+		if _, ok := s.socket.GetInterceptor(id); !ok {
+			delete(s.requests, key)
+		}
+	}
+}
+
+// HandleOpen sends the Engine.IO handshake to socket.io clients and starts
+// pinging them
+func (a *Adapter) HandleOpen(ctx *websocket.Context) {
+	if ctx.QueryParam("EIO") != "4" || ctx.QueryParam("transport") != "websocket" {
+		return
+	}
+
+	socket := ctx.Socket()
+	sess := newSession(a, socket)
+	socket.Set(sessionKey, sess)
+	socket.SetCodec(sess.codec)
+	ctx.UseCodec(sess.codec)
+
+	handshake, err := json.Marshal(map[string]any{
+		"sid":          socket.ID(),
+		"upgrades":     []string{},
+		"pingInterval": a.pingInterval.Milliseconds(),
+		"pingTimeout":  a.pingTimeout.Milliseconds(),
+		"maxPayload":   a.maxPayload,
+	})
+
+	if err != nil {
+		ctx.Error = err
+		return
+	}
+
+	if err := socket.Send(websocket.MessageText, append([]byte{engineOpen}, handshake...)); err != nil {
+		ctx.Error = err
+		return
+	}
+
+	go a.heartbeat(socket, sess)
+}
+
+func (a *Adapter) heartbeat(socket *websocket.Socket, sess *session) {
+	ticker := time.NewTicker(a.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-socket.Done():
+			return
+		}
+
+		sess.prune()
+		select {
+		case <-sess.pong:
+		default:
+		}
+
+		if err := socket.Send(websocket.MessageText, []byte{enginePing}); err != nil {
+			return
+		}
+
+		timeout := time.NewTimer(a.pingTimeout)
+		select {
+		case <-sess.pong:
+			timeout.Stop()
+		case <-timeout.C:
+			socket.Close(websocket.StatusPolicyViolation, "ping timeout", websocket.ServerCloseSource)
+			return
+		case <-socket.Done():
+			timeout.Stop()
+			return
+		}
+	}
+}
+
+func (a *Adapter) Handle(ctx *websocket.Context) {
+	value, ok := ctx.GetFromSocket(sessionKey)
+	if !ok {
+		ctx.Next()
+		return
+	}
+
+	sess := value.(*session)
+	if ctx.MessageType() == websocket.MessageBinary {
+		ctx.Error = ErrBinaryNotSupported
+		return
+	}
+
+	raw := string(ctx.RawData())
+	if raw == "" {
+		ctx.Error = errInvalidPacket
+		return
+	}
+
+	switch raw[0] {
+	case enginePing:
+		// Probes sent by clients upgrading from polling
+		a.send(ctx.Socket(), append([]byte{enginePong}, raw[1:]...))
+	case enginePong:
+		select {
+		case sess.pong <- struct{}{}:
+		default:
+		}
+	case engineClose:
+		ctx.Close()
+	case engineUpgrade, engineNoop:
+	case engineMessage:
+		a.handlePacket(ctx, sess, raw[1:])
+	default:
+		ctx.Error = errInvalidPacket
+	}
+}
+
+func (a *Adapter) handlePacket(ctx *websocket.Context, sess *session, raw string) {
+	p, err := parsePacket(raw)
+	if err != nil {
+		ctx.Error = err
+		return
+	}
+
+	switch p.kind {
+	case packetConnect:
+		a.connect(ctx, sess, p)
+	case packetDisconnect:
+		sess.setConnected(p.namespace, false)
+	case packetEvent, packetAck:
+		if !sess.connected(p.namespace) {
+			return
+		}
+
+		var args []json.RawMessage
+		if err := json.Unmarshal(p.payload, &args); err != nil {
+			ctx.Error = fmt.Errorf("%w: %v", websocket.ErrInvalidData, err)
+			return
+		}
+
+		if p.kind == packetEvent {
+			var event string
+			if len(args) == 0 || json.Unmarshal(args[0], &event) != nil {
+				ctx.Error = fmt.Errorf("%w: event without name", websocket.ErrInvalidData)
+				return
+			}
+
+			ctx.SetMessageEvent(a.namespaces[p.namespace] + event)
+			args = args[1:]
+		}
+
+		if p.ack != "" {
+			ctx.SetMessageID(sess.codec.inboundID(p))
+		}
+
+		if data := argsData(args); data != nil {
+			ctx.SetMessageData(data)
+		}
+
+		ctx.SetMessageMeta(map[string]any{"namespace": p.namespace})
+		ctx.UseCodec(sess.codec)
+		ctx.Next()
+	case packetBinaryEvent, packetBinaryAck:
+		ctx.Error = ErrBinaryNotSupported
+	default:
+		ctx.Error = errInvalidPacket
+	}
+}
+
+func (a *Adapter) connect(ctx *websocket.Context, sess *session, p *packet) {
+	if _, ok := a.namespaces[p.namespace]; !ok {
+		a.connectError(ctx, p.namespace, websocket.NewError(websocket.CodeNotFound, "Invalid namespace"))
+		return
+	}
+
+	if a.authorizer != nil {
+		if err := a.authorizer(ctx, p.namespace, p.payload); err != nil {
+			a.connectError(ctx, p.namespace, err)
+			return
+		}
+	}
+
+	sess.setConnected(p.namespace, true)
+	payload, _ := json.Marshal(map[string]string{"sid": ctx.SocketID()})
+	a.send(ctx.Socket(), (&packet{kind: packetConnect, namespace: p.namespace, payload: payload}).encode())
+}
+
+func (a *Adapter) connectError(ctx *websocket.Context, namespace string, err error) {
+	wsErr := websocket.AsError(err)
+	body := map[string]any{"message": wsErr.Message}
+	if wsErr.Details != nil {
+		body["data"] = wsErr.Details
+	}
+
+	payload, _ := json.Marshal(body)
+	a.send(ctx.Socket(), (&packet{kind: packetConnectError, namespace: namespace, payload: payload}).encode())
+}
+
+// send writes a packet that is not the reply to a message, logging failures
+// other than a closed socket
+func (a *Adapter) send(socket *websocket.Socket, data []byte) {
+	if err := socket.Send(websocket.MessageText, data); err != nil && !errors.Is(err, websocket.ErrSocketClosed) {
+		a.logger.WithError(err).WithField("socket", socket.ID()).Error("failed to send socket.io packet")
+	}
+}
+
+// split returns the namespace of an event and its name within it
+func (a *Adapter) split(event string) (string, string) {
+	for _, namespace := range a.prefixes {
+		if prefix := a.namespaces[namespace]; strings.HasPrefix(event, prefix) {
+			return namespace, event[len(prefix):]
+		}
+	}
+
+	return "/", event
+}
+
+// argsData is the message data for the arguments of an emit: nothing, the
+// only argument, or an array of all of them
+func argsData(args []json.RawMessage) []byte {
+	switch len(args) {
+	case 0:
+		return nil
+	case 1:
+		return args[0]
+	default:
+		data, _ := json.Marshal(args)
+		return data
+	}
+}
+
+func toArgs(data any) []any {
+	switch v := data.(type) {
+	case nil:
+		return []any{}
+	case Args:
+		return v
+	default:
+		return []any{v}
+	}
+}
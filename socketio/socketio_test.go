@@ -0,0 +1,161 @@
+package socketio_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	jsonmiddleware "github.com/snapflowio/websocket/middleware/json"
+	"github.com/snapflowio/websocket/socketio"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+// Fixtures are hand-written exchanges in the wire format of socket.io-client
+// 4, not recordings of a real client. Lines starting with "> " are sent by
+// the client and lines starting with "< " by the server; <sid> stands for the
+// socket ID.
+var fixtures = []struct {
+	name     string
+	exchange string
+}{
+	{"connect", `
+> 40
+< 40{"sid":"<sid>"}`},
+	{"connect namespace", `
+> 40/admin,{"token":"secret"}
+< 40/admin,{"sid":"<sid>"}`},
+	{"connect unknown namespace", `
+> 40/nope,
+< 44/nope,{"message":"Invalid namespace"}`},
+	{"connect unauthorized", `
+> 40/admin,{"token":"wrong"}
+< 44/admin,{"message":"bad token"}`},
+	{"event", `
+> 40
+< 40{"sid":"<sid>"}
+> 42["echo","hi"]
+< 42["echoed","hi"]`},
+	{"event with several arguments", `
+> 40
+< 40{"sid":"<sid>"}
+> 420["add",1,2]
+< 430[3]`},
+	{"event in namespace", `
+> 40/admin,{"token":"secret"}
+< 40/admin,{"sid":"<sid>"}
+> 42/admin,7["ping"]
+< 43/admin,7["pong"]`},
+	{"event before connect", `
+> 421["add",1,2]`},
+	{"error ack", `
+> 40
+< 40{"sid":"<sid>"}
+> 422["missing"]
+< 432[{"error":{"code":"not_found","message":"no such thing"}}]`},
+	{"server request", `
+> 40
+< 40{"sid":"<sid>"}
+> 421["ask"]
+< 420["message","question"]
+> 430["answer"]
+< 431["answer"]`},
+	{"binary event", `
+> 40
+< 40{"sid":"<sid>"}
+> 451-["echo",{"_placeholder":true,"num":0}]`},
+	{"ping probe", `
+> 2probe
+< 3probe`},
+}
+
+func newServer(t *testing.T) *ws.Server {
+	t.Helper()
+	io := socketio.New(
+		socketio.WithNamespaces("/admin"),
+		socketio.WithAuthorizer(func(ctx *ws.Context, namespace string, auth json.RawMessage) error {
+			if namespace == "/admin" && !strings.Contains(string(auth), `"secret"`) {
+				return ws.NewError(ws.CodeUnauthorized, "bad token")
+			}
+
+			return nil
+		}),
+	)
+
+	server := ws.NewServer()
+	if err := server.Use(io); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Use(jsonmiddleware.Middleware()); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]any{
+		"echo": func(ctx *ws.Context) {
+			var text string
+			ctx.Unmarshal(&text)
+			ctx.SendEvent("echoed", text)
+		},
+		"add": ws.Typed(func(ctx *ws.Context, args []int) (int, error) {
+			return args[0] + args[1], nil
+		}),
+		"admin.ping": func(ctx *ws.Context) {
+			ctx.Reply("pong")
+		},
+		"missing": func(ctx *ws.Context) {
+			ctx.Error = ws.NewError(ws.CodeNotFound, "no such thing")
+		},
+		"ask": func(ctx *ws.Context) {
+			var answer string
+			if err := ctx.RequestIntoWithTimeout("question", &answer, time.Second); err != nil {
+				ctx.Error = err
+				return
+			}
+
+			ctx.Reply(answer)
+		},
+	}
+
+	for event, handler := range handlers {
+		if err := server.On(event, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return server
+}
+
+func TestFixtures(t *testing.T) {
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			client := wstest.NewClient(t, newServer(t), wstest.WithQuery(map[string]string{
+				"EIO":       "4",
+				"transport": "websocket",
+			}))
+
+			handshake := string(client.Receive().Raw)
+			if !strings.HasPrefix(handshake, "0{") || !strings.Contains(handshake, `"sid":"`+client.SocketID()+`"`) {
+				t.Fatalf("handshake = %s", handshake)
+			}
+
+			lines := strings.Split(strings.TrimSpace(fixture.exchange), "\n")
+			for _, line := range lines {
+				packet := strings.ReplaceAll(line[2:], "<sid>", client.SocketID())
+				switch line[:2] {
+				case "> ":
+					client.Send(ws.MessageText, []byte(packet))
+				case "< ":
+					if got := string(client.Receive().Raw); got != packet {
+						t.Fatalf("got %s, want %s", got, packet)
+					}
+				default:
+					t.Fatalf("bad fixture line %q", line)
+				}
+			}
+
+			client.ExpectNoMessage(20 * time.Millisecond)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package websocket
+
+import "fmt"
+
+// Typed adapts fn into a handler for Server.On. The message data is decoded
+// into a Req with the context's unmarshaler and checked by the server's
+// Validator, and the Res fn returns is sent as the reply to messages sent
+// with an ID. When decoding or validation fails or fn returns an error, it is
+// set as ctx.Error for the server's error handler to report.
+func Typed[Req, Res any](fn func(ctx *Context, req Req) (Res, error)) HandlerFunc {
+	return func(ctx *Context) {
+		var req Req
+		if len(ctx.Data()) > 0 {
+			if err := ctx.Unmarshal(&req); err != nil {
+				ctx.Error = fmt.Errorf("%w: %v", ErrInvalidData, err)
+				return
+			}
+		}
+
+		if err := ctx.Validate(&req); err != nil {
+			ctx.Error = err
+			return
+		}
+
+		res, err := fn(ctx, req)
+		if err != nil {
+			ctx.Error = err
+			return
+		}
+
+		if ctx.HasMessageID() {
+			ctx.Reply(res)
+		}
+	}
+}
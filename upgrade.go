@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"net/http"
+)
+
+// UpgradeDecision is the result of an upgrade handler. A zero Status, or
+// http.StatusSwitchingProtocols, lets the upgrade proceed; any other status
+// rejects the request with that status and Body.
+type UpgradeDecision struct {
+	Status int
+	Body   string
+	// Header is added to the HTTP response, whether the upgrade proceeds or not
+	Header http.Header
+	// Values are stored on the socket, as if set with Socket.Set
+	Values map[string]any
+	// Subprotocol overrides the server's subprotocols for this connection.
+	// It is only negotiated if the client requested it.
+	Subprotocol string
+}
+
+// UpgradeHandler inspects an upgrade request before the websocket handshake.
+// Returning an error rejects the request with the decision's status, or 500
+// when none is set.
+type UpgradeHandler func(r *http.Request) (UpgradeDecision, error)
+
+// Reject returns a decision refusing the upgrade with status and body
+func Reject(status int, body string) UpgradeDecision {
+	return UpgradeDecision{Status: status, Body: body}
+}
+
+// OnUpgrade sets the handler run for every upgrade request before the
+// websocket handshake. Unlike UseOpen handlers it can refuse a client with a
+// plain HTTP response.
+func (s *Server) OnUpgrade(handler UpgradeHandler) {
+	s.upgradeHandler = handler
+}
+
+func (decision UpgradeDecision) rejected() bool {
+	return decision.Status != 0 && decision.Status != http.StatusSwitchingProtocols
+}
+
+// runUpgradeHandler returns the decision for the request, or false after
+// writing the rejection response.
+func (s *Server) runUpgradeHandler(res http.ResponseWriter, req *http.Request) (UpgradeDecision, bool) {
+	if s.upgradeHandler == nil {
+		return UpgradeDecision{}, true
+	}
+
+	decision, err := s.upgradeHandler(req)
+	for key, values := range decision.Header {
+		for _, value := range values {
+			res.Header().Add(key, value)
+		}
+	}
+
+	if err != nil {
+		s.logger.WithError(err).Warn("upgrade request rejected")
+		if !decision.rejected() {
+			decision.Status = http.StatusInternalServerError
+			decision.Body = "Internal Server Error"
+		}
+	}
+
+	if !decision.rejected() {
+		return decision, true
+	}
+
+	res.WriteHeader(decision.Status)
+	if decision.Body != "" {
+		if _, err := res.Write([]byte(decision.Body)); err != nil {
+			s.logger.WithError(err).Error("failed to write error response")
+		}
+	}
+
+	return decision, false
+}
@@ -0,0 +1,109 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	ws "github.com/snapflowio/websocket"
+)
+
+func TestUpgradeHandlerRejects(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		decision ws.UpgradeDecision
+		err      error
+		status   int
+		body     string
+	}{
+		{"reject", ws.Reject(http.StatusForbidden, "go away"), nil, http.StatusForbidden, "go away"},
+		{"error", ws.UpgradeDecision{}, errors.New("no backend"), http.StatusInternalServerError, "Internal Server Error"},
+		{"error with status", ws.Reject(http.StatusTooManyRequests, "slow down"), errors.New("rate limited"), http.StatusTooManyRequests, "slow down"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newJSONServer(t)
+			test.decision.Header = http.Header{"X-Reason": {test.name}}
+			server.OnUpgrade(func(r *http.Request) (ws.UpgradeDecision, error) {
+				return test.decision, test.err
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			conn, res, err := websocket.Dial(ctx, serve(t, server), nil)
+			if err == nil {
+				conn.CloseNow()
+				t.Fatal("upgrade was not rejected")
+			}
+
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != test.status || string(body) != test.body {
+				t.Fatalf("response = %d %q, want %d %q", res.StatusCode, body, test.status, test.body)
+			}
+
+			if got := res.Header.Get("X-Reason"); got != test.name {
+				t.Fatalf("X-Reason = %q, want %q", got, test.name)
+			}
+		})
+	}
+}
+
+func TestUpgradeHandlerSetsValues(t *testing.T) {
+	server := newJSONServer(t)
+	server.OnUpgrade(func(r *http.Request) (ws.UpgradeDecision, error) {
+		return ws.UpgradeDecision{
+			Header: http.Header{"X-User": {"alice"}},
+			Values: map[string]any{"user": r.URL.Query().Get("user")},
+		}, nil
+	})
+
+	users := make(chan any, 1)
+	if err := server.UseOpen(func(ctx *ws.Context) {
+		user, _ := ctx.Socket().Get("user")
+		users <- user
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	conn, res, err := websocket.Dial(ctx, serve(t, server)+"?user=alice", nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+
+	defer conn.CloseNow()
+	if got := res.Header.Get("X-User"); got != "alice" {
+		t.Errorf("X-User = %q, want alice", got)
+	}
+
+	if user := <-users; user != "alice" {
+		t.Fatalf("socket value user = %v, want alice", user)
+	}
+}
+
+func TestUpgradeHandlerChoosesSubprotocol(t *testing.T) {
+	server := newJSONServer(t, ws.WithSubprotocols("json", "msgpack"))
+	server.OnUpgrade(func(r *http.Request) (ws.UpgradeDecision, error) {
+		return ws.UpgradeDecision{Subprotocol: r.URL.Query().Get("protocol")}, nil
+	})
+
+	endpoint := serve(t, server)
+	for _, test := range []struct {
+		override  string
+		requested []string
+		want      string
+	}{
+		{"", []string{"msgpack", "json"}, "json"},
+		{"msgpack", []string{"msgpack", "json"}, "msgpack"},
+		{"msgpack", []string{"json"}, ""},
+	} {
+		conn := dial(t, endpoint+"?protocol="+test.override, &websocket.DialOptions{Subprotocols: test.requested})
+		if got := conn.Subprotocol(); got != test.want {
+			t.Errorf("override %q, client requesting %v: subprotocol %q, want %q", test.override, test.requested, got, test.want)
+		}
+	}
+}
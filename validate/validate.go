@@ -0,0 +1,360 @@
+// Package validate checks structs against rules in their validate tags and
+// reports failures as json.FieldError values named after the JSON fields.
+//
+//	type CreateRoom struct {
+//		Name  string   `json:"name" validate:"required,min=3,max=32"`
+//		Kind  string   `json:"kind" validate:"oneof=public private"`
+//		Slug  string   `json:"slug" validate:"omitempty,regex=^[a-z0-9-]+$"`
+//		Owner *Profile `json:"owner" validate:"required"`
+//	}
+//
+// Rules are separated by commas. regex takes the rest of the tag, so it must
+// come last. Nested structs, pointers to structs and slices of structs are
+// validated too.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/grafana/regexp"
+	websocket "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/json"
+)
+
+// Errors lists the fields that failed validation. It is reported to clients
+// as an Error with CodeValidation, and the json middleware also encodes it
+// as a validation error when it is sent as data.
+type Errors []json.FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, err := range e {
+		parts[i] = err.Field + " " + err.Error
+	}
+
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e Errors) FieldErrors() []json.FieldError {
+	return e
+}
+
+// As converts the errors to a websocket.Error with CodeValidation, listing
+// the fields in its details
+func (e Errors) As(target any) bool {
+	wsErr, ok := target.(**websocket.Error)
+	if !ok {
+		return false
+	}
+
+	fields := make([]json.M, len(e))
+	for i, err := range e {
+		fields[i] = json.M{err.Field: err.Error}
+	}
+
+	*wsErr = &websocket.Error{
+		Code:    websocket.CodeValidation,
+		Message: "Validation error",
+		Details: fields,
+	}
+
+	return true
+}
+
+// Struct validates v, a struct or a pointer to one. It returns Errors when a
+// field breaks its rules and nil otherwise. It panics if a tag is malformed.
+// Struct can be passed to Server.SetValidator.
+func Struct(v any) error {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs Errors
+	validateStruct(value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+type field struct {
+	index     int
+	name      string
+	inline    bool
+	required  bool
+	omitempty bool
+	rules     []rule
+}
+
+type rule struct {
+	name  string
+	param string
+	check func(value reflect.Value) string
+}
+
+var fieldCache sync.Map
+
+func fieldsOf(t reflect.Type) []field {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.([]field)
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+
+		name, tagged, skip := jsonName(sf)
+		if skip {
+			continue
+		}
+
+		f := field{index: i, name: name, inline: sf.Anonymous && !tagged}
+		if tag, ok := sf.Tag.Lookup("validate"); ok && tag != "" && tag != "-" {
+			parseTag(t, sf, tag, &f)
+		}
+
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// jsonName returns the name encoding/json uses for the field and whether
+// the json tag sets it
+func jsonName(sf reflect.StructField) (string, bool, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		return sf.Name, false, false
+	}
+
+	return name, true, false
+}
+
+func parseTag(t reflect.Type, sf reflect.StructField, tag string, f *field) {
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, param, _ := strings.Cut(part, "=")
+		switch name {
+		case "required":
+			f.required = true
+		case "omitempty":
+			f.omitempty = true
+		default:
+			check, err := newCheck(name, param, sf.Type)
+			if err != nil {
+				panic(fmt.Sprintf("validate: invalid tag on %s.%s: %v", t, sf.Name, err))
+			}
+
+			f.rules = append(f.rules, rule{name: name, param: param, check: check})
+		}
+	}
+}
+
+func validateStruct(value reflect.Value, prefix string, errs *Errors) {
+	for _, f := range fieldsOf(value.Type()) {
+		fv := value.Field(f.index)
+		path := prefix
+		if !f.inline {
+			path = join(prefix, f.name)
+		}
+
+		if fv.IsZero() {
+			if f.required {
+				*errs = append(*errs, json.FieldError{Field: path, Error: "is required"})
+				continue
+			}
+
+			if f.omitempty || fv.Kind() == reflect.Pointer {
+				continue
+			}
+		}
+
+		failed := false
+		target := indirect(fv)
+		if target.IsValid() {
+			for _, r := range f.rules {
+				if msg := r.check(target); msg != "" {
+					*errs = append(*errs, json.FieldError{Field: path, Error: msg})
+					failed = true
+					break
+				}
+			}
+		}
+
+		if !failed {
+			validateNested(fv, path, errs)
+		}
+	}
+}
+
+func validateNested(value reflect.Value, path string, errs *Errors) {
+	value = indirect(value)
+	if !value.IsValid() {
+		return
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		validateStruct(value, path, errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			validateNested(value.Index(i), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	}
+}
+
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+
+		value = value.Elem()
+	}
+
+	return value
+}
+
+func join(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+
+	return prefix + "." + name
+}
+
+func newCheck(name, param string, t reflect.Type) (func(reflect.Value) string, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch name {
+	case "min", "max", "len":
+		return sizeCheck(name, param, t)
+	case "oneof":
+		return oneofCheck(param, t)
+	case "regex":
+		if t.Kind() != reflect.String {
+			return nil, fmt.Errorf("regex needs a string field, got %s", t)
+		}
+
+		re, err := regexp.Compile(param)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(value reflect.Value) string {
+			if !re.MatchString(value.String()) {
+				return "has an invalid format"
+			}
+
+			return ""
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown rule %q", name)
+	}
+}
+
+// sizeCheck compares numbers by value and strings, slices and maps by length
+func sizeCheck(name, param string, t reflect.Type) (func(reflect.Value) string, error) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s needs a number, got %q", name, param)
+	}
+
+	var measure func(reflect.Value) float64
+	var unit string
+	switch t.Kind() {
+	case reflect.String:
+		measure = func(v reflect.Value) float64 { return float64(utf8.RuneCountInString(v.String())) }
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		measure = func(v reflect.Value) float64 { return float64(v.Len()) }
+		unit = " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		measure = func(v reflect.Value) float64 { return float64(v.Int()) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		measure = func(v reflect.Value) float64 { return float64(v.Uint()) }
+	case reflect.Float32, reflect.Float64:
+		measure = func(v reflect.Value) float64 { return v.Float() }
+	default:
+		return nil, fmt.Errorf("%s does not apply to %s", name, t)
+	}
+
+	return func(value reflect.Value) string {
+		size := measure(value)
+		switch {
+		case name == "min" && size < limit:
+			return "must be at least " + param + unit
+		case name == "max" && size > limit:
+			return "must be at most " + param + unit
+		case name == "len" && size != limit:
+			return "must be exactly " + param + unit
+		}
+
+		return ""
+	}, nil
+}
+
+func oneofCheck(param string, t reflect.Type) (func(reflect.Value) string, error) {
+	allowed := strings.Fields(param)
+	if len(allowed) == 0 {
+		return nil, fmt.Errorf("oneof needs at least one value")
+	}
+
+	// Values are formatted by kind: fmt would call the String method of
+	// named types, which need not print the number.
+	var format func(reflect.Value) string
+	switch t.Kind() {
+	case reflect.String:
+		format = reflect.Value.String
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		format = func(v reflect.Value) string { return strconv.FormatInt(v.Int(), 10) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		format = func(v reflect.Value) string { return strconv.FormatUint(v.Uint(), 10) }
+	default:
+		return nil, fmt.Errorf("oneof does not apply to %s", t)
+	}
+
+	msg := "must be one of: " + strings.Join(allowed, ", ")
+	return func(value reflect.Value) string {
+		s := format(value)
+		for _, a := range allowed {
+			if s == a {
+				return ""
+			}
+		}
+
+		return msg
+	}, nil
+}
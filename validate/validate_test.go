@@ -0,0 +1,235 @@
+package validate_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	websocket "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/json"
+	"github.com/snapflowio/websocket/validate"
+)
+
+type level int
+
+func (l level) String() string {
+	return [...]string{"debug", "info", "warn"}[l]
+}
+
+type size uint8
+
+type rules struct {
+	Name     string         `json:"name" validate:"required,min=3,max=5"`
+	Code     string         `json:"code" validate:"omitempty,len=2"`
+	Tags     []string       `json:"tags" validate:"max=2"`
+	Labels   map[string]int `json:"labels" validate:"omitempty,min=1"`
+	Age      int            `json:"age" validate:"min=18,max=99"`
+	Count    uint           `json:"count" validate:"max=10"`
+	Ratio    float64        `json:"ratio" validate:"max=1.5"`
+	Kind     string         `json:"kind" validate:"oneof=public private"`
+	Level    level          `json:"level" validate:"oneof=1 2"`
+	Size     size           `json:"size" validate:"omitempty,oneof=8 16"`
+	Slug     string         `json:"slug" validate:"omitempty,regex=^[a-z0-9,-]+$"`
+	Limit    *int           `json:"limit" validate:"min=1"`
+	Comment  string         `json:"-" validate:"required"`
+	Untagged string         `validate:"omitempty,len=1"`
+}
+
+func valid() rules {
+	return rules{Name: "room", Age: 30, Kind: "public", Level: 1}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestRules(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		modify func(r *rules)
+		want   validate.Errors
+	}{
+		{"valid", func(r *rules) {}, nil},
+		{"required", func(r *rules) { r.Name = "" }, validate.Errors{{Field: "name", Error: "is required"}}},
+		{"min length", func(r *rules) { r.Name = "ab" }, validate.Errors{{Field: "name", Error: "must be at least 3 characters"}}},
+		{"length counts runes", func(r *rules) { r.Name = "ééé" }, nil},
+		{"max length", func(r *rules) { r.Name = "abcdef" }, validate.Errors{{Field: "name", Error: "must be at most 5 characters"}}},
+		{"omitempty skips zero", func(r *rules) { r.Code = "" }, nil},
+		{"exact length", func(r *rules) { r.Code = "abc" }, validate.Errors{{Field: "code", Error: "must be exactly 2 characters"}}},
+		{"slice length", func(r *rules) { r.Tags = []string{"a", "b", "c"} }, validate.Errors{{Field: "tags", Error: "must be at most 2 items"}}},
+		{"empty map is not zero", func(r *rules) { r.Labels = map[string]int{} }, validate.Errors{{Field: "labels", Error: "must be at least 1 items"}}},
+		{"zero int checked", func(r *rules) { r.Age = 0 }, validate.Errors{{Field: "age", Error: "must be at least 18"}}},
+		{"int max", func(r *rules) { r.Age = 100 }, validate.Errors{{Field: "age", Error: "must be at most 99"}}},
+		{"uint max", func(r *rules) { r.Count = 11 }, validate.Errors{{Field: "count", Error: "must be at most 10"}}},
+		{"float max", func(r *rules) { r.Ratio = 1.6 }, validate.Errors{{Field: "ratio", Error: "must be at most 1.5"}}},
+		{"float within max", func(r *rules) { r.Ratio = 1.5 }, nil},
+		{"oneof string", func(r *rules) { r.Kind = "secret" }, validate.Errors{{Field: "kind", Error: "must be one of: public, private"}}},
+		{"oneof named int with String", func(r *rules) { r.Level = 2 }, nil},
+		{"oneof named int rejected", func(r *rules) { r.Level = 0 }, validate.Errors{{Field: "level", Error: "must be one of: 1, 2"}}},
+		{"oneof uint", func(r *rules) { r.Size = 16 }, nil},
+		{"oneof uint rejected", func(r *rules) { r.Size = 4 }, validate.Errors{{Field: "size", Error: "must be one of: 8, 16"}}},
+		{"regex with comma", func(r *rules) { r.Slug = "a,b-1" }, nil},
+		{"regex", func(r *rules) { r.Slug = "Not Valid" }, validate.Errors{{Field: "slug", Error: "has an invalid format"}}},
+		{"nil pointer skipped", func(r *rules) { r.Limit = nil }, nil},
+		{"pointer checked", func(r *rules) { r.Limit = intPtr(0) }, validate.Errors{{Field: "limit", Error: "must be at least 1"}}},
+		{"untagged field keeps its name", func(r *rules) { r.Untagged = "ab" }, validate.Errors{{Field: "Untagged", Error: "must be exactly 1 characters"}}},
+		{"several fields", func(r *rules) {
+			r.Name = ""
+			r.Age = 5
+		}, validate.Errors{{Field: "name", Error: "is required"}, {Field: "age", Error: "must be at least 18"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := valid()
+			test.modify(&r)
+			checkErrors(t, validate.Struct(r), test.want)
+		})
+	}
+}
+
+type profile struct {
+	Email string `json:"email" validate:"required"`
+}
+
+type member struct {
+	Name string `json:"name" validate:"min=2"`
+}
+
+type Base struct {
+	ID string `json:"id" validate:"required"`
+}
+
+type room struct {
+	Base
+	Owner   *profile `json:"owner" validate:"required"`
+	Backup  *profile `json:"backup"`
+	Admin   profile  `json:"admin"`
+	Members []member `json:"members" validate:"max=3"`
+	Guests  []*member
+}
+
+func TestNested(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		room room
+		want validate.Errors
+	}{
+		{"valid", room{
+			Base:    Base{ID: "1"},
+			Owner:   &profile{Email: "a@b"},
+			Admin:   profile{Email: "c@d"},
+			Members: []member{{Name: "al"}},
+			Guests:  []*member{nil, {Name: "bo"}},
+		}, nil},
+		{"invalid", room{
+			Owner:   &profile{},
+			Backup:  &profile{},
+			Members: []member{{Name: "al"}, {Name: "b"}},
+			Guests:  []*member{{Name: "c"}},
+		}, validate.Errors{
+			{Field: "id", Error: "is required"},
+			{Field: "owner.email", Error: "is required"},
+			{Field: "backup.email", Error: "is required"},
+			{Field: "admin.email", Error: "is required"},
+			{Field: "members[1].name", Error: "must be at least 2 characters"},
+			{Field: "Guests[0].name", Error: "must be at least 2 characters"},
+		}},
+		{"required pointer", room{Base: Base{ID: "1"}, Admin: profile{Email: "c@d"}}, validate.Errors{
+			{Field: "owner", Error: "is required"},
+		}},
+		{"failed rule skips elements", room{
+			Base:    Base{ID: "1"},
+			Owner:   &profile{Email: "a@b"},
+			Admin:   profile{Email: "c@d"},
+			Members: []member{{}, {}, {}, {}},
+		}, validate.Errors{{Field: "members", Error: "must be at most 3 items"}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			checkErrors(t, validate.Struct(&test.room), test.want)
+		})
+	}
+}
+
+func TestStructIgnoresNonStructs(t *testing.T) {
+	var nilRoom *room
+	for _, v := range []any{nil, nilRoom, 42, "text", []room{{}}} {
+		if err := validate.Struct(v); err != nil {
+			t.Errorf("Struct(%#v) = %v, want nil", v, err)
+		}
+	}
+}
+
+func TestErrorsAsWebsocketError(t *testing.T) {
+	err := validate.Struct(room{})
+	var wsErr *websocket.Error
+	if !errors.As(err, &wsErr) {
+		t.Fatalf("%v is not a websocket.Error", err)
+	}
+
+	if wsErr.Code != websocket.CodeValidation {
+		t.Fatalf("code = %s, want %s", wsErr.Code, websocket.CodeValidation)
+	}
+
+	want := []json.M{{"id": "is required"}, {"owner": "is required"}, {"admin.email": "is required"}}
+	if !reflect.DeepEqual(wsErr.Details, want) {
+		t.Fatalf("details = %v, want %v", wsErr.Details, want)
+	}
+
+	if got, want := err.Error(), "validation failed: id is required; owner is required; admin.email is required"; got != want {
+		t.Fatalf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestMalformedTagsPanic(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		v    any
+	}{
+		{"unknown rule", struct {
+			A string `validate:"email"`
+		}{}},
+		{"size without number", struct {
+			A string `validate:"min=abc"`
+		}{}},
+		{"size on bool", struct {
+			A bool `validate:"max=1"`
+		}{}},
+		{"empty oneof", struct {
+			A string `validate:"oneof="`
+		}{}},
+		{"oneof on float", struct {
+			A float64 `validate:"oneof=1.5 2"`
+		}{}},
+		{"regex on int", struct {
+			A int `validate:"regex=^1$"`
+		}{}},
+		{"invalid regex", struct {
+			A string `validate:"regex=["`
+		}{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Struct did not panic")
+				}
+			}()
+
+			validate.Struct(test.v)
+		})
+	}
+}
+
+func checkErrors(t *testing.T, err error, want validate.Errors) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Fatalf("Struct = %v, want nil", err)
+		}
+
+		return
+	}
+
+	var got validate.Errors
+	if !errors.As(err, &got) || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Struct = %#v, want %#v", err, want)
+	}
+}
@@ -0,0 +1,31 @@
+package websocket
+
+// Validator checks a message decoded by a Typed handler. The error it returns
+// is reported to the client through AsError, so it should convert to an
+// Error with CodeValidation, like validate.Errors does.
+type Validator func(v any) error
+
+// SetValidator sets the validator Typed handlers and Context.Validate use
+func (s *Server) SetValidator(validator Validator) {
+	s.validator = validator
+}
+
+func WithValidator(validator Validator) ServerOption {
+	return func(s *Server) {
+		s.SetValidator(validator)
+	}
+}
+
+// Validate runs the server's validator on v. It returns nil when no
+// validator is set.
+func (c *Context) Validate(v any) error {
+	if c.socket == nil {
+		return ErrContextFreed
+	}
+
+	if c.socket.server == nil || c.socket.server.validator == nil {
+		return nil
+	}
+
+	return c.socket.server.validator(v)
+}
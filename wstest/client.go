@@ -0,0 +1,377 @@
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	ws "github.com/snapflowio/websocket"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+// Message is a message the server sent to a TestClient. ID, Event, Meta,
+// Payload and Error are filled in when the message is a json middleware
+// envelope.
+type Message struct {
+	Type    ws.MessageType
+	Raw     []byte
+	ID      string
+	Event   string
+	Meta    map[string]any
+	Payload json.RawMessage
+	Error   *ws.Error
+}
+
+// Unmarshal decodes the message's data into v
+func (m *Message) Unmarshal(v any) error {
+	return json.Unmarshal(m.Payload, v)
+}
+
+type envelope struct {
+	ID    string          `json:"id,omitempty"`
+	Event string          `json:"event,omitempty"`
+	Meta  map[string]any  `json:"meta,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Error *ws.Error       `json:"error,omitempty"`
+}
+
+type clientOptions struct {
+	info    ws.ConnectionInfo
+	timeout time.Duration
+}
+
+type ClientOption func(o *clientOptions)
+
+func WithHeader(header http.Header) ClientOption {
+	return func(o *clientOptions) {
+		o.info.Headers = header
+	}
+}
+
+func WithQuery(query map[string]string) ClientOption {
+	return func(o *clientOptions) {
+		o.info.Query = query
+	}
+}
+
+// WithSubprotocol sets the subprotocol the connection reports as negotiated
+func WithSubprotocol(subprotocol string) ClientOption {
+	return func(o *clientOptions) {
+		o.info.Subprotocol = subprotocol
+	}
+}
+
+func WithRemoteAddr(addr string) ClientOption {
+	return func(o *clientOptions) {
+		o.info.RemoteAddr = addr
+	}
+}
+
+// WithTimeout sets how long the helpers wait for the server
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// TestClient is connected to a Server through a Pipe. Its helpers fail the
+// test when the server does not answer in time.
+type TestClient struct {
+	tb      testing.TB
+	conn    *Conn
+	socket  *ws.Socket
+	timeout time.Duration
+	done    chan struct{}
+	mu      sync.Mutex
+	inbox   []*Message
+	ready   chan struct{}
+}
+
+// NewClient connects a client to server and waits until the server has
+// registered its socket. The client is closed when the test ends.
+func NewClient(tb testing.TB, server *ws.Server, opts ...ClientOption) *TestClient {
+	tb.Helper()
+	o := &clientOptions{
+		info:    ws.ConnectionInfo{RemoteAddr: "pipe"},
+		timeout: DefaultTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	serverConn, clientConn := Pipe()
+	c := &TestClient{
+		tb:      tb,
+		conn:    clientConn,
+		timeout: o.timeout,
+		done:    make(chan struct{}),
+		ready:   make(chan struct{}),
+	}
+
+	info := o.info
+	go func() {
+		defer close(c.done)
+		server.HandleConnection(&info, serverConn)
+	}()
+
+	go c.readLoop()
+	c.socket = c.waitForSocket(server, &info)
+	tb.Cleanup(func() {
+		c.conn.Close(ws.StatusNormalClosure, "")
+		<-c.done
+	})
+
+	return c
+}
+
+func (c *TestClient) waitForSocket(server *ws.Server, info *ws.ConnectionInfo) *ws.Socket {
+	c.tb.Helper()
+	deadline := time.Now().Add(c.timeout)
+	for time.Now().Before(deadline) {
+		for _, socket := range server.Sockets() {
+			if socket.ConnectionInfo() == info {
+				return socket
+			}
+		}
+
+		select {
+		case <-c.done:
+			c.tb.Fatalf("wstest: server closed the connection with status %v", c.conn.CloseStatus())
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	c.tb.Fatalf("wstest: server did not register the socket within %v", c.timeout)
+	return nil
+}
+
+// Socket returns the server side socket of the client
+func (c *TestClient) Socket() *ws.Socket {
+	return c.socket
+}
+
+// SocketID returns the ID of the server side socket
+func (c *TestClient) SocketID() string {
+	return c.socket.ID()
+}
+
+// Conn returns the client end of the pipe
+func (c *TestClient) Conn() *Conn {
+	return c.conn
+}
+
+// Send writes a raw message to the server
+func (c *TestClient) Send(messageType ws.MessageType, data []byte) {
+	c.tb.Helper()
+	if err := c.conn.Write(context.Background(), &ws.SocketMessage{Type: messageType, Data: data}); err != nil {
+		c.tb.Fatalf("wstest: failed to send message: %v", err)
+	}
+}
+
+// Emit sends an event in a json middleware envelope
+func (c *TestClient) Emit(event string, data any) {
+	c.tb.Helper()
+	c.send(&envelope{Event: event}, data)
+}
+
+// Request sends an event with a new message ID and returns the server's
+// reply to it
+func (c *TestClient) Request(event string, data any) *Message {
+	c.tb.Helper()
+	id := uuid.NewString()
+	c.send(&envelope{ID: id, Event: event}, data)
+	return c.next(func(msg *Message) bool {
+		return msg.ID == id
+	}, "reply to "+event)
+}
+
+// RequestInto is like Request and decodes the reply's data into v. It fails
+// the test if the server replies with an error.
+func (c *TestClient) RequestInto(event string, data any, v any) {
+	c.tb.Helper()
+	reply := c.Request(event, data)
+	if reply.Error != nil {
+		c.tb.Fatalf("wstest: %s failed: %v", event, reply.Error)
+	}
+
+	if err := reply.Unmarshal(v); err != nil {
+		c.tb.Fatalf("wstest: failed to decode reply to %s: %v", event, err)
+	}
+}
+
+// Reply answers a message the server sent with Context.Request
+func (c *TestClient) Reply(msg *Message, data any) {
+	c.tb.Helper()
+	if msg.ID == "" {
+		c.tb.Fatalf("wstest: cannot reply to a message without ID")
+	}
+
+	c.send(&envelope{ID: msg.ID}, data)
+}
+
+// Receive returns the next message from the server
+func (c *TestClient) Receive() *Message {
+	c.tb.Helper()
+	return c.next(func(msg *Message) bool {
+		return true
+	}, "a message")
+}
+
+// ReceiveEvent returns the next message with the given event. Messages with
+// other events are left for later calls.
+func (c *TestClient) ReceiveEvent(event string) *Message {
+	c.tb.Helper()
+	return c.next(func(msg *Message) bool {
+		return msg.Event == event
+	}, "event "+event)
+}
+
+// ExpectEvent fails the test unless the next message has the given event
+func (c *TestClient) ExpectEvent(event string) *Message {
+	c.tb.Helper()
+	msg := c.Receive()
+	if msg.Event != event {
+		c.tb.Fatalf("wstest: expected event %q, got %q: %s", event, msg.Event, msg.Raw)
+	}
+
+	return msg
+}
+
+// ExpectNoMessage fails the test if the server sends anything within d
+func (c *TestClient) ExpectNoMessage(d time.Duration) {
+	c.tb.Helper()
+	deadline := time.After(d)
+	for {
+		c.mu.Lock()
+		if len(c.inbox) > 0 {
+			msg := c.inbox[0]
+			c.mu.Unlock()
+			c.tb.Fatalf("wstest: expected no message, got %s", msg.Raw)
+			return
+		}
+
+		ready := c.ready
+		c.mu.Unlock()
+		select {
+		case <-ready:
+		case <-deadline:
+			return
+		}
+	}
+}
+
+// Close closes the connection from the client side with status and waits
+// for the server to run its close handlers
+func (c *TestClient) Close(status ws.Status, reason string) {
+	c.tb.Helper()
+	c.conn.Close(status, reason)
+	c.Wait()
+}
+
+// Drop cuts the connection without a close status, like a network failure,
+// and waits for the server to handle it
+func (c *TestClient) Drop() {
+	c.tb.Helper()
+	c.conn.Drop()
+	c.Wait()
+}
+
+// Wait waits for the server to finish handling the connection
+func (c *TestClient) Wait() {
+	c.tb.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(c.timeout):
+		c.tb.Fatalf("wstest: server did not finish the connection within %v", c.timeout)
+	}
+}
+
+// ExpectClosed waits for the server to close the connection and fails the
+// test unless it used status
+func (c *TestClient) ExpectClosed(status ws.Status) {
+	c.tb.Helper()
+	c.Wait()
+	if got := c.conn.CloseStatus(); got != status {
+		c.tb.Fatalf("wstest: expected close status %v, got %v", status, got)
+	}
+}
+
+// Done is closed once the server finished handling the connection
+func (c *TestClient) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *TestClient) send(env *envelope, data any) {
+	c.tb.Helper()
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			c.tb.Fatalf("wstest: failed to encode data: %v", err)
+		}
+
+		env.Data = raw
+	}
+
+	raw, err := json.Marshal(env)
+	if err != nil {
+		c.tb.Fatalf("wstest: failed to encode message: %v", err)
+	}
+
+	c.Send(ws.MessageText, raw)
+}
+
+// next removes and returns the first message matching match
+func (c *TestClient) next(match func(msg *Message) bool, what string) *Message {
+	c.tb.Helper()
+	deadline := time.After(c.timeout)
+	for {
+		c.mu.Lock()
+		for i, msg := range c.inbox {
+			if match(msg) {
+				c.inbox = append(c.inbox[:i], c.inbox[i+1:]...)
+				c.mu.Unlock()
+				return msg
+			}
+		}
+
+		ready := c.ready
+		c.mu.Unlock()
+		select {
+		case <-ready:
+		case <-deadline:
+			c.tb.Fatalf("wstest: timed out after %v waiting for %s", c.timeout, what)
+			return nil
+		}
+	}
+}
+
+func (c *TestClient) readLoop() {
+	for {
+		msg, err := c.conn.Read(context.Background())
+		if err != nil {
+			return
+		}
+
+		received := &Message{Type: msg.Type, Raw: msg.RawData}
+		var env envelope
+		if json.Unmarshal(msg.RawData, &env) == nil {
+			received.ID = env.ID
+			received.Event = env.Event
+			received.Meta = env.Meta
+			received.Payload = env.Data
+			received.Error = env.Error
+		}
+
+		c.mu.Lock()
+		c.inbox = append(c.inbox, received)
+		close(c.ready)
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+	}
+}
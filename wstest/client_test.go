@@ -0,0 +1,129 @@
+package wstest_test
+
+import (
+	"testing"
+	"time"
+
+	ws "github.com/snapflowio/websocket"
+	"github.com/snapflowio/websocket/middleware/json"
+	"github.com/snapflowio/websocket/wstest"
+)
+
+type room struct {
+	Room string `json:"room"`
+}
+
+type sum struct {
+	A int `json:"a"`
+	B int `json:"b"`
+}
+
+type total struct {
+	Sum int `json:"sum"`
+}
+
+func newServer(t *testing.T) *ws.Server {
+	t.Helper()
+	server := ws.NewServer(ws.WithCodec(json.Codec()))
+	if err := server.Use(json.Middleware()); err != nil {
+		t.Fatal(err)
+	}
+
+	handlers := map[string]any{
+		"join": func(ctx *ws.Context) {
+			var msg room
+			ctx.Unmarshal(&msg)
+			ctx.Join(msg.Room)
+			ctx.Reply(msg)
+		},
+		"leave": func(ctx *ws.Context) {
+			var msg room
+			ctx.Unmarshal(&msg)
+			ctx.Leave(msg.Room)
+			ctx.Reply(msg)
+		},
+		"shout": func(ctx *ws.Context) {
+			var msg room
+			ctx.Unmarshal(&msg)
+			ctx.To(msg.Room).EmitEvent("shouted", msg)
+		},
+		"add": ws.Typed(func(ctx *ws.Context, req sum) (total, error) {
+			return total{Sum: req.A + req.B}, nil
+		}),
+		"ask": func(ctx *ws.Context) {
+			var answer total
+			if err := ctx.RequestInto(sum{A: 2, B: 3}, &answer); err != nil {
+				ctx.Error = err
+				return
+			}
+
+			ctx.Reply(answer)
+		},
+	}
+
+	for event, handler := range handlers {
+		if err := server.On(event, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return server
+}
+
+func TestJoinAndLeave(t *testing.T) {
+	server := newServer(t)
+	client := wstest.NewClient(t, server)
+	client.Request("join", room{Room: "lobby"})
+	lobby := server.Rooms().GetRoom("lobby")
+	if lobby == nil || !lobby.Has(client.Socket()) {
+		t.Fatal("socket did not join the room")
+	}
+
+	client.Request("leave", room{Room: "lobby"})
+	if lobby.Has(client.Socket()) {
+		t.Fatal("socket did not leave the room")
+	}
+}
+
+func TestRoomEmit(t *testing.T) {
+	server := newServer(t)
+	alice := wstest.NewClient(t, server)
+	bob := wstest.NewClient(t, server)
+	carol := wstest.NewClient(t, server)
+	alice.Request("join", room{Room: "lobby"})
+	bob.Request("join", room{Room: "lobby"})
+
+	alice.Emit("shout", room{Room: "lobby"})
+	var got room
+	if err := bob.ExpectEvent("shouted").Unmarshal(&got); err != nil || got.Room != "lobby" {
+		t.Fatalf("member got %+v, %v", got, err)
+	}
+
+	alice.ExpectNoMessage(20 * time.Millisecond)
+	carol.ExpectNoMessage(20 * time.Millisecond)
+}
+
+func TestClientRequest(t *testing.T) {
+	client := wstest.NewClient(t, newServer(t))
+	var got total
+	client.RequestInto("add", sum{A: 1, B: 2}, &got)
+	if got.Sum != 3 {
+		t.Fatalf("sum = %d, want 3", got.Sum)
+	}
+}
+
+func TestServerRequest(t *testing.T) {
+	client := wstest.NewClient(t, newServer(t))
+	client.Emit("ask", nil)
+	request := client.Receive()
+	var question sum
+	if err := request.Unmarshal(&question); err != nil {
+		t.Fatal(err)
+	}
+
+	client.Reply(request, total{Sum: question.A + question.B})
+	var answer total
+	if err := client.Receive().Unmarshal(&answer); err != nil || answer.Sum != 5 {
+		t.Fatalf("handler replied %+v, %v", answer, err)
+	}
+}
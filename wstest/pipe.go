@@ -0,0 +1,175 @@
+// Package wstest runs a Server in memory for tests: a pipe based
+// SocketConnection pair and a TestClient that drives Server.HandleConnection
+// without a network.
+package wstest
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/coder/websocket"
+	ws "github.com/snapflowio/websocket"
+)
+
+// Conn is one end of an in-memory connection created by Pipe. Messages
+// written to one end are read from the other in order.
+type Conn struct {
+	pipe  *pipe
+	inbox *queue
+	peer  *Conn
+}
+
+var _ ws.SocketConnection = &Conn{}
+var _ ws.Pinger = &Conn{}
+
+type pipe struct {
+	mu     sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+type queue struct {
+	mu       sync.Mutex
+	messages []*ws.SocketMessage
+	ready    chan struct{}
+}
+
+// Pipe returns the two ends of an in-memory connection
+func Pipe() (*Conn, *Conn) {
+	p := &pipe{closed: make(chan struct{})}
+	a := &Conn{pipe: p, inbox: newQueue()}
+	b := &Conn{pipe: p, inbox: newQueue()}
+	a.peer = b
+	b.peer = a
+	return a, b
+}
+
+func newQueue() *queue {
+	return &queue{ready: make(chan struct{}, 1)}
+}
+
+func (q *queue) push(msg *ws.SocketMessage) {
+	q.mu.Lock()
+	q.messages = append(q.messages, msg)
+	q.mu.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) pop() *ws.SocketMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.messages) == 0 {
+		return nil
+	}
+
+	msg := q.messages[0]
+	q.messages = q.messages[1:]
+	return msg
+}
+
+// Read returns the next message written by the peer. Once the pipe is
+// closed, the messages written before are still returned, then the close
+// error: a websocket.CloseError carrying the status given to Close, or the
+// error given to Drop.
+func (c *Conn) Read(ctx context.Context) (*ws.SocketMessage, error) {
+	for {
+		if msg := c.inbox.pop(); msg != nil {
+			return msg, nil
+		}
+
+		select {
+		case <-c.inbox.ready:
+		case <-c.pipe.closed:
+			if msg := c.inbox.pop(); msg != nil {
+				return msg, nil
+			}
+
+			return nil, c.pipe.closeErr()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *Conn) Write(ctx context.Context, msg *ws.SocketMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if c.pipe.isClosed() {
+		return net.ErrClosed
+	}
+
+	c.peer.inbox.push(&ws.SocketMessage{
+		Type:    msg.Type,
+		RawData: append([]byte(nil), msg.Data...),
+	})
+
+	return nil
+}
+
+// Close closes both ends. Reads on either end fail with a
+// websocket.CloseError carrying status and reason.
+func (c *Conn) Close(status ws.Status, reason string) error {
+	if !c.pipe.close(websocket.CloseError{Code: status, Reason: reason}) {
+		return net.ErrClosed
+	}
+
+	return nil
+}
+
+// Drop closes both ends without a close status, like a lost connection
+func (c *Conn) Drop() {
+	c.pipe.close(io.ErrUnexpectedEOF)
+}
+
+// Ping succeeds immediately while the pipe is open
+func (c *Conn) Ping(ctx context.Context) error {
+	if c.pipe.isClosed() {
+		return net.ErrClosed
+	}
+
+	return ctx.Err()
+}
+
+// Closed is closed once either end is closed
+func (c *Conn) Closed() <-chan struct{} {
+	return c.pipe.closed
+}
+
+// CloseStatus returns the status the pipe was closed with, or -1 if it is
+// open or was dropped
+func (c *Conn) CloseStatus() ws.Status {
+	c.pipe.mu.Lock()
+	defer c.pipe.mu.Unlock()
+	return websocket.CloseStatus(c.pipe.err)
+}
+
+func (p *pipe) close(err error) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return false
+	}
+
+	p.err = err
+	close(p.closed)
+	return true
+}
+
+func (p *pipe) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+func (p *pipe) closeErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}